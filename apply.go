@@ -2,55 +2,340 @@ package kg
 
 import (
 	apps "k8s.io/api/apps/v1"
+	autoscaling "k8s.io/api/autoscaling/v2"
+	batch "k8s.io/api/batch/v1"
 	core "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	policy "k8s.io/api/policy/v1"
+	rbac "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
-type Deployments []*apps.Deployment
+// Deployments, like the other typed selections below, holds selected objects of one kind in Items.
+// Apply records the failure of an op on the Cluster the objects were selected from. A selection
+// built directly from objects, such as Deployments{Items: objs}, belongs to no Cluster, and a
+// failing op panics with an *OpError.
+type Deployments struct {
+	c     *Cluster
+	Items []*apps.Deployment
+}
 
 func (s Deployments) Apply(ops ...DeploymentOp) {
-	for _, c := range s {
+	for _, obj := range s.Items {
+		for _, op := range ops {
+			s.c.runOp(obj, func() { op(obj) })
+		}
+	}
+}
+
+type PersistentVolumes struct {
+	c     *Cluster
+	Items []*core.PersistentVolume
+}
+
+func (s PersistentVolumes) Apply(ops ...PersistentVolumeOp) {
+	for _, obj := range s.Items {
 		for _, op := range ops {
-			op(c)
+			s.c.runOp(obj, func() { op(obj) })
 		}
 	}
 }
 
-type PersistentVolumeClaims []*core.PersistentVolumeClaim
+type PersistentVolumeClaims struct {
+	c     *Cluster
+	Items []*core.PersistentVolumeClaim
+}
 
 func (s PersistentVolumeClaims) Apply(ops ...PersistentVolumeClaimOp) {
-	for _, c := range s {
+	for _, obj := range s.Items {
 		for _, op := range ops {
-			op(c)
+			s.c.runOp(obj, func() { op(obj) })
 		}
 	}
 }
 
-type StatefulSets []*apps.StatefulSet
+type StatefulSets struct {
+	c     *Cluster
+	Items []*apps.StatefulSet
+}
 
 func (s StatefulSets) Apply(ops ...StatefulSetOp) {
-	for _, c := range s {
+	for _, obj := range s.Items {
 		for _, op := range ops {
-			op(c)
+			s.c.runOp(obj, func() { op(obj) })
 		}
 	}
 }
 
-type Secrets []*core.Secret
+type DaemonSets struct {
+	c     *Cluster
+	Items []*apps.DaemonSet
+}
+
+func (s DaemonSets) Apply(ops ...DaemonSetOp) {
+	for _, obj := range s.Items {
+		for _, op := range ops {
+			s.c.runOp(obj, func() { op(obj) })
+		}
+	}
+}
+
+type Jobs struct {
+	c     *Cluster
+	Items []*batch.Job
+}
+
+func (s Jobs) Apply(ops ...JobOp) {
+	for _, obj := range s.Items {
+		for _, op := range ops {
+			s.c.runOp(obj, func() { op(obj) })
+		}
+	}
+}
+
+type CronJobs struct {
+	c     *Cluster
+	Items []*batch.CronJob
+}
+
+func (s CronJobs) Apply(ops ...CronJobOp) {
+	for _, obj := range s.Items {
+		for _, op := range ops {
+			s.c.runOp(obj, func() { op(obj) })
+		}
+	}
+}
+
+type ReplicaSets struct {
+	c     *Cluster
+	Items []*apps.ReplicaSet
+}
+
+func (s ReplicaSets) Apply(ops ...ReplicaSetOp) {
+	for _, obj := range s.Items {
+		for _, op := range ops {
+			s.c.runOp(obj, func() { op(obj) })
+		}
+	}
+}
+
+type Workloads struct {
+	c     *Cluster
+	Items []Workload
+}
+
+func (s Workloads) Apply(ops ...PodTemplateOp) {
+	for _, w := range s.Items {
+		for _, op := range ops {
+			s.c.runOp(w.Object, func() { op(w.Template) })
+		}
+	}
+}
+
+type Secrets struct {
+	c     *Cluster
+	Items []*core.Secret
+}
 
 func (s Secrets) Apply(ops ...SecretOp) {
-	for _, c := range s {
+	for _, obj := range s.Items {
 		for _, op := range ops {
-			op(c)
+			s.c.runOp(obj, func() { op(obj) })
 		}
 	}
 }
 
-type ConfigMaps []*core.ConfigMap
+type ConfigMaps struct {
+	c     *Cluster
+	Items []*core.ConfigMap
+}
 
 func (s ConfigMaps) Apply(ops ...ConfigMapOp) {
-	for _, c := range s {
+	for _, obj := range s.Items {
+		for _, op := range ops {
+			s.c.runOp(obj, func() { op(obj) })
+		}
+	}
+}
+
+type Services struct {
+	c     *Cluster
+	Items []*core.Service
+}
+
+func (s Services) Apply(ops ...ServiceOp) {
+	for _, obj := range s.Items {
+		for _, op := range ops {
+			s.c.runOp(obj, func() { op(obj) })
+		}
+	}
+}
+
+type Ingresses struct {
+	c     *Cluster
+	Items []*networking.Ingress
+}
+
+func (s Ingresses) Apply(ops ...IngressOp) {
+	for _, obj := range s.Items {
+		for _, op := range ops {
+			s.c.runOp(obj, func() { op(obj) })
+		}
+	}
+}
+
+type HorizontalPodAutoscalers struct {
+	c     *Cluster
+	Items []*autoscaling.HorizontalPodAutoscaler
+}
+
+func (s HorizontalPodAutoscalers) Apply(ops ...HorizontalPodAutoscalerOp) {
+	for _, obj := range s.Items {
+		for _, op := range ops {
+			s.c.runOp(obj, func() { op(obj) })
+		}
+	}
+}
+
+type PodDisruptionBudgets struct {
+	c     *Cluster
+	Items []*policy.PodDisruptionBudget
+}
+
+func (s PodDisruptionBudgets) Apply(ops ...PodDisruptionBudgetOp) {
+	for _, obj := range s.Items {
+		for _, op := range ops {
+			s.c.runOp(obj, func() { op(obj) })
+		}
+	}
+}
+
+type NetworkPolicies struct {
+	c     *Cluster
+	Items []*networking.NetworkPolicy
+}
+
+func (s NetworkPolicies) Apply(ops ...NetworkPolicyOp) {
+	for _, obj := range s.Items {
+		for _, op := range ops {
+			s.c.runOp(obj, func() { op(obj) })
+		}
+	}
+}
+
+type Namespaces struct {
+	c     *Cluster
+	Items []*core.Namespace
+}
+
+func (s Namespaces) Apply(ops ...NamespaceOp) {
+	for _, obj := range s.Items {
+		for _, op := range ops {
+			s.c.runOp(obj, func() { op(obj) })
+		}
+	}
+}
+
+type ResourceQuotas struct {
+	c     *Cluster
+	Items []*core.ResourceQuota
+}
+
+func (s ResourceQuotas) Apply(ops ...ResourceQuotaOp) {
+	for _, obj := range s.Items {
+		for _, op := range ops {
+			s.c.runOp(obj, func() { op(obj) })
+		}
+	}
+}
+
+type LimitRanges struct {
+	c     *Cluster
+	Items []*core.LimitRange
+}
+
+func (s LimitRanges) Apply(ops ...LimitRangeOp) {
+	for _, obj := range s.Items {
+		for _, op := range ops {
+			s.c.runOp(obj, func() { op(obj) })
+		}
+	}
+}
+
+type Roles struct {
+	c     *Cluster
+	Items []*rbac.Role
+}
+
+func (s Roles) Apply(ops ...PolicyRuleOp) {
+	for _, obj := range s.Items {
+		for _, op := range ops {
+			s.c.runOp(obj, func() { op(&obj.Rules) })
+		}
+	}
+}
+
+type ClusterRoles struct {
+	c     *Cluster
+	Items []*rbac.ClusterRole
+}
+
+func (s ClusterRoles) Apply(ops ...PolicyRuleOp) {
+	for _, obj := range s.Items {
+		for _, op := range ops {
+			s.c.runOp(obj, func() { op(&obj.Rules) })
+		}
+	}
+}
+
+type RoleBindings struct {
+	c     *Cluster
+	Items []*rbac.RoleBinding
+}
+
+func (s RoleBindings) Apply(ops ...BindingOp) {
+	for _, obj := range s.Items {
+		for _, op := range ops {
+			s.c.runOp(obj, func() { op(&obj.Subjects, &obj.RoleRef) })
+		}
+	}
+}
+
+type ClusterRoleBindings struct {
+	c     *Cluster
+	Items []*rbac.ClusterRoleBinding
+}
+
+func (s ClusterRoleBindings) Apply(ops ...BindingOp) {
+	for _, obj := range s.Items {
+		for _, op := range ops {
+			s.c.runOp(obj, func() { op(&obj.Subjects, &obj.RoleRef) })
+		}
+	}
+}
+
+type ServiceAccounts struct {
+	c     *Cluster
+	Items []*core.ServiceAccount
+}
+
+func (s ServiceAccounts) Apply(ops ...ServiceAccountOp) {
+	for _, obj := range s.Items {
+		for _, op := range ops {
+			s.c.runOp(obj, func() { op(obj) })
+		}
+	}
+}
+
+type UnstructuredObjects struct {
+	c     *Cluster
+	Items []*unstructured.Unstructured
+}
+
+func (s UnstructuredObjects) Apply(ops ...UnstructuredOp) {
+	for _, obj := range s.Items {
 		for _, op := range ops {
-			op(c)
+			s.c.runOp(obj, func() { op(obj) })
 		}
 	}
 }
@@ -1,23 +1,64 @@
 package kg
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 
 	yaml "gopkg.in/yaml.v2"
-	"k8s.io/api/apps/v1"
-	kube "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer/json"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/client-go/kubernetes/scheme"
 )
 
 func ModifyCluster(rootDir, newFilesDir string, apply func(*Cluster)) error {
+	c, err := loadCluster(rootDir, newFilesDir)
+	if err != nil {
+		return err
+	}
+
+	c.run(apply)
+
+	return c.Write()
+}
+
+// DryRunCluster is like ModifyCluster, but instead of writing any files it returns the changes
+// that would be written.
+func DryRunCluster(rootDir, newFilesDir string, apply func(*Cluster)) (*Diff, error) {
+	c, err := loadCluster(rootDir, newFilesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	c.run(apply)
+
+	return c.Diff()
+}
+
+// run calls apply with c. A failure reported by Fail outside of an op applied with Apply, e.g. by
+// a constructor such as PodSpec, aborts apply and is recorded on c.
+func (c *Cluster) run(apply func(*Cluster)) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.recordFailure(r)
+		}
+	}()
+	apply(c)
+}
+
+// loadCluster loads the Kubernetes configuration files under rootDir.
+func loadCluster(rootDir, newFilesDir string) (*Cluster, error) {
 	var yamlFiles []string
 	filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
 		if info.IsDir() {
@@ -33,44 +74,176 @@ func ModifyCluster(rootDir, newFilesDir string, apply func(*Cluster)) error {
 		return nil
 	})
 
-	c, err := NewCluster(yamlFiles, newFilesDir)
-	if err != nil {
-		return err
-	}
-
-	apply(c)
-
-	return c.Write()
+	return NewCluster(yamlFiles, newFilesDir)
 }
 
 func NewCluster(files []string, newFilesDir string) (*Cluster, error) {
-	c := &Cluster{files: make(map[string]runtime.Object), newFilesDir: newFilesDir}
+	c := &Cluster{
+		files:       make(map[string][]*document),
+		newFilesDir: newFilesDir,
+		touched:     make(map[runtime.Object]bool),
+		index:       make(map[Object]string),
+	}
 	for _, file := range files {
 		b, err := ioutil.ReadFile(file)
 		if err != nil {
 			return nil, err
 		}
 
-		obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(b, nil, nil)
+		docs, err := splitDocuments(b)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("%s: %v", file, err)
 		}
 
-		c.files[file] = obj
+		for i, raw := range docs {
+			doc, err := loadDocument(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s: document %d: %v", file, i, err)
+			}
+			c.files[file] = append(c.files[file], doc)
+			c.index[doc.obj.(Object)] = file
+		}
 	}
 
 	return c, nil
 }
 
+// splitDocuments splits a multi-document YAML file on "---" separators. Documents that contain
+// nothing but whitespace and comments are dropped.
+func splitDocuments(b []byte) ([][]byte, error) {
+	var docs [][]byte
+	r := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(b)))
+	for {
+		doc, err := r.Read()
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var v interface{}
+		if err := yaml.Unmarshal(doc, &v); err != nil {
+			return nil, err
+		}
+		if v == nil {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+}
+
+// loadDocument decodes a single YAML document.
+func loadDocument(raw []byte) (*document, error) {
+	obj, err := decode(raw)
+	if err != nil {
+		return nil, err
+	}
+	orig, err := untyped(obj)
+	if err != nil {
+		return nil, err
+	}
+	return &document{obj: obj, raw: raw, orig: orig}, nil
+}
+
+// decode deserializes a YAML document into a typed object if its kind is registered with the
+// client-go scheme, and into an *unstructured.Unstructured otherwise.
+func decode(raw []byte) (runtime.Object, error) {
+	obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(raw, nil, nil)
+	if err == nil || !runtime.IsNotRegisteredError(err) {
+		return obj, err
+	}
+
+	b, err := utilyaml.ToJSON(raw)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{}
+	if err := u.UnmarshalJSON(b); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
 type Cluster struct {
-	// files is a map from filename, relative to the cluster root directory, to the Kubernetes
-	// object deserialized from that file
-	files map[string]runtime.Object
+	// files is a map from filename, relative to the cluster root directory, to the YAML
+	// documents in that file. Documents are stored in the order they appear in the file, so an
+	// object is identified by its file and document index.
+	files map[string][]*document
 
 	// newFilesDir is the directory to which to add new files created by modifications
 	newFilesDir string
+
+	// writeMode controls how Write serializes objects that were loaded from files
+	writeMode WriteMode
+
+	// modified is the list of files written or removed by the last call to Write
+	modified []string
+
+	// touched is the set of objects that have been selected, changed or created, which Prune keeps
+	touched map[runtime.Object]bool
+
+	// index maps every object that has belonged to the cluster, including deleted ones, to its
+	// file
+	index map[Object]string
+
+	// errs holds the errors recorded while modifying the cluster
+	errs []error
+
+	// mapper is the mapper set with SetRESTMapper, or nil to use DefaultRESTMapper
+	mapper meta.RESTMapper
+}
+
+// document is a single YAML document in a cluster file.
+type document struct {
+	// obj is the Kubernetes object deserialized from the document
+	obj runtime.Object
+
+	// raw is the YAML source of the document and orig is the untyped form of obj at load time.
+	// Both are nil for objects created by modifications.
+	raw  []byte
+	orig map[string]interface{}
+
+	// deleted is whether the object has been deleted from the cluster
+	deleted bool
 }
 
+// changed reports whether the document's object is new or differs semantically from the object
+// that was loaded.
+func (d *document) changed() (bool, error) {
+	if d.raw == nil {
+		return true, nil
+	}
+	cur, err := untyped(d.obj)
+	if err != nil {
+		return false, err
+	}
+	return !reflect.DeepEqual(cur, d.orig), nil
+}
+
+// WriteMode controls how Write serializes objects that were loaded from files.
+type WriteMode int
+
+const (
+	// Reformat writes objects in the form emitted by the Kubernetes serializer, with keys
+	// sorted alphabetically and comments dropped.
+	Reformat WriteMode = iota
+
+	// PreserveFormatting patches only the fields that changed into the YAML an object was
+	// loaded from, leaving comments, key order, quoting and unchanged fields as they were.
+	// Documents whose object did not change are written back verbatim. Objects created by
+	// modifications are written as in Reformat mode.
+	PreserveFormatting
+)
+
+// SetWriteMode sets the mode Write uses to serialize objects. The default is Reformat.
+func (c *Cluster) SetWriteMode(mode WriteMode) {
+	c.writeMode = mode
+}
+
+// Write writes every file that contains a new, changed or deleted object, and removes files whose
+// objects have all been deleted. Files whose objects are all semantically unchanged are left
+// untouched.
 func (c *Cluster) Write() error {
 	for file, _ := range c.files {
 		if strings.HasPrefix(file, strings.TrimSuffix(c.newFilesDir, string(filepath.Separator))+string(filepath.Separator)) {
@@ -81,151 +254,506 @@ func (c *Cluster) Write() error {
 		}
 	}
 
-	for file, obj := range c.files {
-		e := json.NewYAMLSerializer(json.DefaultMetaFactory, nil, nil)
-
-		var buf bytes.Buffer
-		err := e.Encode(obj, &buf)
-		if err != nil {
+	contents, removed, err := c.render()
+	if err != nil {
+		return err
+	}
+	c.modified = nil
+	for file, b := range contents {
+		if err := ioutil.WriteFile(file, b, 0666); err != nil {
 			return err
 		}
-
-		var untyped map[string]interface{}
-		yaml.Unmarshal(buf.Bytes(), &untyped)
-		sanitize(untyped)
-
-		sanitized, err := yaml.Marshal(untyped)
-		if err != nil {
+		c.modified = append(c.modified, file)
+		if err := c.written(file, b); err != nil {
 			return err
 		}
-
-		if err := ioutil.WriteFile(file, sanitized, 0666); err != nil {
+	}
+	for _, file := range removed {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
 			return err
 		}
+		delete(c.files, file)
+		c.modified = append(c.modified, file)
 	}
+	sort.Strings(c.modified)
 	return nil
 }
 
-func (c *Cluster) Deployments(names ...string) (selected Deployments) {
-	selectAll := false
-	nameSet := make(map[string]struct{})
-	for _, name := range names {
-		if name == "*" {
-			selectAll = true
-		} else {
-			nameSet[name] = struct{}{}
+// written updates the documents of file after b was written to it, so that later writes compare
+// the objects with what was written. The deleted documents are gone from the file, so later writes
+// need not remove them again.
+func (c *Cluster) written(file string, b []byte) error {
+	raws, err := splitDocuments(b)
+	if err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	var live []*document
+	for _, doc := range c.files[file] {
+		if !doc.deleted {
+			live = append(live, doc)
 		}
 	}
-	for _, obj := range c.files {
-		if deploy, ok := obj.(*v1.Deployment); ok {
-			_, exists := nameSet[deploy.ObjectMeta.Name]
-			if selectAll || exists {
-				selected = append(selected, deploy)
-			}
+	if len(raws) != len(live) {
+		return fmt.Errorf("%s: wrote %d documents but the file holds %d objects", file, len(raws), len(live))
+	}
+	for i, doc := range live {
+		orig, err := untyped(doc.obj)
+		if err != nil {
+			return fmt.Errorf("%s: document %d: %v", file, i, err)
 		}
+		doc.raw, doc.orig = raws[i], orig
 	}
-	return selected
+	c.files[file] = live
+	return nil
 }
 
-func (c *Cluster) StatefulSets(names ...string) (selected StatefulSets) {
-	selectAll := false
-	nameSet := make(map[string]struct{})
-	for _, name := range names {
-		if name == "*" {
-			selectAll = true
-		} else {
-			nameSet[name] = struct{}{}
+// Modified returns the files written or removed by the last call to Write, sorted by name.
+func (c *Cluster) Modified() []string {
+	return c.modified
+}
+
+// Diff returns the changes Write would make, without writing anything.
+func (c *Cluster) Diff() (*Diff, error) {
+	contents, removed, err := c.render()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Diff{Files: make(map[string]string), Deleted: removed}
+	for _, file := range removed {
+		old, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
 		}
+		d.Files[file] = unifiedDiff(file, "/dev/null", string(old), "")
 	}
-	for _, obj := range c.files {
-		if sset, ok := obj.(*v1.StatefulSet); ok {
-			_, exists := nameSet[sset.ObjectMeta.Name]
-			if selectAll || exists {
-				selected = append(selected, sset)
-			}
+	for file, b := range contents {
+		fromName := file
+		old, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			fromName = "/dev/null"
+			d.Created = append(d.Created, file)
+		} else if err != nil {
+			return nil, err
+		}
+
+		if diff := unifiedDiff(fromName, file, string(old), string(b)); diff != "" {
+			d.Files[file] = diff
 		}
 	}
-	return selected
+	sort.Strings(d.Created)
+	return d, nil
 }
 
-func (c *Cluster) PersistentVolumeClaims(names ...string) (selected PersistentVolumeClaims) {
-	selectAll := false
-	nameSet := make(map[string]struct{})
-	for _, name := range names {
-		if name == "*" {
-			selectAll = true
-		} else {
-			nameSet[name] = struct{}{}
-		}
+// render returns the contents Write would write to each new or changed file, and the files it
+// would remove because all of their objects were deleted. It fails if any errors were recorded
+// while modifying the cluster.
+func (c *Cluster) render() (contents map[string][]byte, removed []string, err error) {
+	if err := c.Err(); err != nil {
+		return nil, nil, err
 	}
-	for _, obj := range c.files {
-		if pvc, ok := obj.(*kube.PersistentVolumeClaim); ok {
-			_, exists := nameSet[pvc.ObjectMeta.Name]
-			if selectAll || exists {
-				selected = append(selected, pvc)
+
+	contents = make(map[string][]byte)
+	for file, docs := range c.files {
+		var live []*document
+		changed := false
+		for i, doc := range docs {
+			if doc.deleted {
+				// Deleting an object that was never written changes nothing
+				changed = changed || doc.raw != nil
+				continue
+			}
+			live = append(live, doc)
+			if !changed {
+				var err error
+				if changed, err = doc.changed(); err != nil {
+					return nil, nil, fmt.Errorf("%s: document %d: %v", file, i, err)
+				}
+			}
+		}
+		if !changed {
+			continue
+		}
+		if len(live) == 0 {
+			removed = append(removed, file)
+			continue
+		}
+
+		var out bytes.Buffer
+		for i, doc := range live {
+			var b []byte
+			var err error
+			if c.writeMode == PreserveFormatting && doc.raw != nil {
+				b, err = encodePatched(doc)
+			} else {
+				b, err = encode(doc.obj)
 			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %s %s: %v", file, doc.obj.GetObjectKind().GroupVersionKind().Kind, doc.obj.(Object).GetName(), err)
+			}
+			if i > 0 {
+				out.WriteString("---\n")
+			}
+			out.Write(b)
 		}
+		contents[file] = out.Bytes()
 	}
-	return selected
+	sort.Strings(removed)
+	return contents, removed, nil
 }
 
-func (c *Cluster) ConfigMaps(names ...string) (selected ConfigMaps) {
-	selectAll := false
-	nameSet := make(map[string]struct{})
-	for _, name := range names {
-		if name == "*" {
-			selectAll = true
-		} else {
-			nameSet[name] = struct{}{}
+// Delete deletes objs from the cluster. Write removes their documents from their files, and
+// removes files that no longer contain any objects.
+func (c *Cluster) Delete(objs ...Object) {
+	deleted := make(map[Object]bool, len(objs))
+	for _, obj := range objs {
+		deleted[obj] = true
+	}
+	for _, docs := range c.files {
+		for _, doc := range docs {
+			if deleted[doc.obj.(Object)] {
+				doc.deleted = true
+			}
 		}
 	}
-	for _, obj := range c.files {
-		if cm, ok := obj.(*kube.ConfigMap); ok {
-			_, exists := nameSet[cm.ObjectMeta.Name]
-			if selectAll || exists {
-				selected = append(selected, cm)
+}
+
+// Prune deletes every object that has not been selected by a typed selection, such as
+// Deployments(...) or Select(...).Services(), changed by the cluster, e.g. by SetNamespace or
+// RewriteRegistry, or created since the cluster was loaded. Call it after all other modifications
+// to delete the objects the program no longer declares.
+func (c *Cluster) Prune() {
+	for _, docs := range c.files {
+		for _, doc := range docs {
+			if !c.touched[doc.obj] {
+				doc.deleted = true
 			}
 		}
 	}
-	return selected
 }
 
-func (c *Cluster) Secrets(names ...string) (selected Secrets) {
-	selectAll := false
-	nameSet := make(map[string]bool)
-	for _, name := range names {
-		if name == "*" {
-			selectAll = true
-		} else {
-			nameSet[name] = false
-		}
-	}
-	for _, obj := range c.files {
-		if secret, ok := obj.(*kube.Secret); ok {
-			_, exists := nameSet[secret.ObjectMeta.Name]
-			if exists {
-				nameSet[secret.ObjectMeta.Name] = true
-				if selectAll {
-					selected = append(selected, secret)
-				}
+// touch records that obj was selected, changed or created, so that Prune keeps it.
+func (c *Cluster) touch(obj runtime.Object) {
+	c.touched[obj] = true
+}
+
+// encode serializes obj to YAML, stripping the fields removed by sanitize unless obj is
+// unstructured.
+func encode(obj runtime.Object) ([]byte, error) {
+	e := json.NewYAMLSerializer(json.DefaultMetaFactory, nil, nil)
+
+	var buf bytes.Buffer
+	if err := e.Encode(obj, &buf); err != nil {
+		return nil, err
+	}
+
+	var untyped map[string]interface{}
+	if err := yaml.Unmarshal(buf.Bytes(), &untyped); err != nil {
+		return nil, err
+	}
+	if _, ok := obj.(*unstructured.Unstructured); !ok {
+		sanitize(untyped)
+	}
+
+	return yaml.Marshal(untyped)
+}
+
+func (c *Cluster) sortedFiles() []string {
+	files := make([]string, 0, len(c.files))
+	for file := range c.files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// objects returns every object in the cluster that has not been deleted, ordered by file name and then by position
+// within the file.
+func (c *Cluster) objects() []runtime.Object {
+	var objs []runtime.Object
+	for _, file := range c.sortedFiles() {
+		for _, doc := range c.files[file] {
+			if !doc.deleted {
+				objs = append(objs, doc.obj)
 			}
 		}
 	}
+	return objs
+}
+
+// The selection methods below come in two forms. Kinds(names...) selects the existing objects of
+// that kind with the given names, where the name "*" selects all of them.
+// EnsureKinds(names...) additionally creates an object for each name that has none, in the new
+// file ${name}.${Kind}.yaml in newFilesDir.
+
+func (c *Cluster) Deployments(names ...string) Deployments {
+	return c.Select(Named(names...)).Deployments()
+}
+
+func (c *Cluster) EnsureDeployments(names ...string) Deployments {
+	return c.selectOrCreate(names, func(name string) runtime.Object { return newDeployment(name) }).Deployments()
+}
+
+func (c *Cluster) StatefulSets(names ...string) StatefulSets {
+	return c.Select(Named(names...)).StatefulSets()
+}
+
+func (c *Cluster) EnsureStatefulSets(names ...string) StatefulSets {
+	return c.selectOrCreate(names, func(name string) runtime.Object { return newStatefulSet(name) }).StatefulSets()
+}
+
+func (c *Cluster) DaemonSets(names ...string) DaemonSets {
+	return c.Select(Named(names...)).DaemonSets()
+}
+
+func (c *Cluster) EnsureDaemonSets(names ...string) DaemonSets {
+	return c.selectOrCreate(names, func(name string) runtime.Object { return newDaemonSet(name) }).DaemonSets()
+}
+
+func (c *Cluster) Jobs(names ...string) Jobs {
+	return c.Select(Named(names...)).Jobs()
+}
+
+func (c *Cluster) EnsureJobs(names ...string) Jobs {
+	return c.selectOrCreate(names, func(name string) runtime.Object { return newJob(name) }).Jobs()
+}
+
+func (c *Cluster) CronJobs(names ...string) CronJobs {
+	return c.Select(Named(names...)).CronJobs()
+}
+
+func (c *Cluster) EnsureCronJobs(names ...string) CronJobs {
+	return c.selectOrCreate(names, func(name string) runtime.Object { return newCronJob(name) }).CronJobs()
+}
+
+func (c *Cluster) ReplicaSets(names ...string) ReplicaSets {
+	return c.Select(Named(names...)).ReplicaSets()
+}
+
+func (c *Cluster) PersistentVolumes(names ...string) PersistentVolumes {
+	return c.Select(Named(names...)).PersistentVolumes()
+}
+
+func (c *Cluster) EnsurePersistentVolumes(names ...string) PersistentVolumes {
+	return c.selectOrCreate(names, func(name string) runtime.Object { return newPersistentVolume(name) }).PersistentVolumes()
+}
+
+func (c *Cluster) PersistentVolumeClaims(names ...string) PersistentVolumeClaims {
+	return c.Select(Named(names...)).PersistentVolumeClaims()
+}
+
+func (c *Cluster) EnsurePersistentVolumeClaims(names ...string) PersistentVolumeClaims {
+	return c.selectOrCreate(names, func(name string) runtime.Object { return newPersistentVolumeClaim(name) }).PersistentVolumeClaims()
+}
+
+func (c *Cluster) ConfigMaps(names ...string) ConfigMaps {
+	return c.Select(Named(names...)).ConfigMaps()
+}
+
+func (c *Cluster) EnsureConfigMaps(names ...string) ConfigMaps {
+	return c.selectOrCreate(names, func(name string) runtime.Object { return ConfigMap(name) }).ConfigMaps()
+}
+
+// Secrets is like EnsureSecrets: it selects the Secrets with the given names, creating any that do
+// not exist. Use ExistingSecrets to select only existing Secrets.
+func (c *Cluster) Secrets(names ...string) Secrets {
+	return c.EnsureSecrets(names...)
+}
+
+// ExistingSecrets selects the existing Secrets with the given names.
+func (c *Cluster) ExistingSecrets(names ...string) Secrets {
+	return c.Select(Named(names...)).Secrets()
+}
+
+// EnsureSecrets selects the Secrets with the given names, creating any that do not exist.
+func (c *Cluster) EnsureSecrets(names ...string) Secrets {
+	return c.selectOrCreate(names, func(name string) runtime.Object { return Secret(name) }).Secrets()
+}
+
+func (c *Cluster) Services(names ...string) Services {
+	return c.Select(Named(names...)).Services()
+}
+
+func (c *Cluster) EnsureServices(names ...string) Services {
+	return c.selectOrCreate(names, func(name string) runtime.Object { return Service(name) }).Services()
+}
+
+func (c *Cluster) Ingresses(names ...string) Ingresses {
+	return c.Select(Named(names...)).Ingresses()
+}
+
+func (c *Cluster) EnsureIngresses(names ...string) Ingresses {
+	return c.selectOrCreate(names, func(name string) runtime.Object { return Ingress(name) }).Ingresses()
+}
+
+func (c *Cluster) HorizontalPodAutoscalers(names ...string) HorizontalPodAutoscalers {
+	return c.Select(Named(names...)).HorizontalPodAutoscalers()
+}
+
+func (c *Cluster) EnsureHorizontalPodAutoscalers(names ...string) HorizontalPodAutoscalers {
+	return c.selectOrCreate(names, func(name string) runtime.Object { return newHorizontalPodAutoscaler(name) }).HorizontalPodAutoscalers()
+}
+
+func (c *Cluster) PodDisruptionBudgets(names ...string) PodDisruptionBudgets {
+	return c.Select(Named(names...)).PodDisruptionBudgets()
+}
+
+func (c *Cluster) EnsurePodDisruptionBudgets(names ...string) PodDisruptionBudgets {
+	return c.selectOrCreate(names, func(name string) runtime.Object { return newPodDisruptionBudget(name) }).PodDisruptionBudgets()
+}
+
+func (c *Cluster) NetworkPolicies(names ...string) NetworkPolicies {
+	return c.Select(Named(names...)).NetworkPolicies()
+}
+
+func (c *Cluster) EnsureNetworkPolicies(names ...string) NetworkPolicies {
+	return c.selectOrCreate(names, func(name string) runtime.Object { return newNetworkPolicy(name) }).NetworkPolicies()
+}
+
+func (c *Cluster) Namespaces(names ...string) Namespaces {
+	return c.Select(Named(names...)).Namespaces()
+}
+
+func (c *Cluster) EnsureNamespaces(names ...string) Namespaces {
+	return c.selectOrCreate(names, func(name string) runtime.Object { return newNamespace(name) }).Namespaces()
+}
+
+func (c *Cluster) ResourceQuotas(names ...string) ResourceQuotas {
+	return c.Select(Named(names...)).ResourceQuotas()
+}
+
+func (c *Cluster) EnsureResourceQuotas(names ...string) ResourceQuotas {
+	return c.selectOrCreate(names, func(name string) runtime.Object { return newResourceQuota(name) }).ResourceQuotas()
+}
+
+func (c *Cluster) LimitRanges(names ...string) LimitRanges {
+	return c.Select(Named(names...)).LimitRanges()
+}
+
+func (c *Cluster) EnsureLimitRanges(names ...string) LimitRanges {
+	return c.selectOrCreate(names, func(name string) runtime.Object { return newLimitRange(name) }).LimitRanges()
+}
+
+func (c *Cluster) Roles(names ...string) Roles {
+	return c.Select(Named(names...)).Roles()
+}
+
+func (c *Cluster) EnsureRoles(names ...string) Roles {
+	return c.selectOrCreate(names, func(name string) runtime.Object { return Role(name) }).Roles()
+}
+
+func (c *Cluster) ClusterRoles(names ...string) ClusterRoles {
+	return c.Select(Named(names...)).ClusterRoles()
+}
+
+func (c *Cluster) EnsureClusterRoles(names ...string) ClusterRoles {
+	return c.selectOrCreate(names, func(name string) runtime.Object { return ClusterRole(name) }).ClusterRoles()
+}
+
+func (c *Cluster) RoleBindings(names ...string) RoleBindings {
+	return c.Select(Named(names...)).RoleBindings()
+}
+
+func (c *Cluster) EnsureRoleBindings(names ...string) RoleBindings {
+	return c.selectOrCreate(names, func(name string) runtime.Object { return RoleBinding(name) }).RoleBindings()
+}
+
+func (c *Cluster) ClusterRoleBindings(names ...string) ClusterRoleBindings {
+	return c.Select(Named(names...)).ClusterRoleBindings()
+}
+
+func (c *Cluster) EnsureClusterRoleBindings(names ...string) ClusterRoleBindings {
+	return c.selectOrCreate(names, func(name string) runtime.Object { return ClusterRoleBinding(name) }).ClusterRoleBindings()
+}
+
+func (c *Cluster) ServiceAccounts(names ...string) ServiceAccounts {
+	return c.Select(Named(names...)).ServiceAccounts()
+}
+
+func (c *Cluster) EnsureServiceAccounts(names ...string) ServiceAccounts {
+	return c.selectOrCreate(names, func(name string) runtime.Object { return ServiceAccount(name) }).ServiceAccounts()
+}
+
+// Workloads selects the objects of every kind that runs pods from a pod template which match all
+// of the filters.
+func (c *Cluster) Workloads(filters ...Filter) Workloads {
+	return c.Select(filters...).Workloads()
+}
+
+// Unstructured selects objects whose kind is not registered with the client-go scheme, such as
+// custom resources. Empty fields of gvk match any group, version or kind.
+func (c *Cluster) Unstructured(gvk schema.GroupVersionKind, names ...string) UnstructuredObjects {
+	return c.Select(Named(names...)).Unstructured(gvk)
+}
+
+// selectOrCreate selects the objects with the given names. For each name other than "*" that no
+// object of the kind returned by newObj has, it creates one with newObj.
+func (c *Cluster) selectOrCreate(names []string, newObj func(name string) runtime.Object) *Selection {
+	s := c.Select(Named(names...))
+	kind := reflect.TypeOf(newObj(""))
+	found := make(map[string]bool)
+	for _, obj := range s.objs {
+		if reflect.TypeOf(obj) == kind {
+			found[obj.(Object).GetName()] = true
+		}
+	}
 
-	// Create non-existent secrets
-	for name, found := range nameSet {
-		if found {
+	for _, name := range names {
+		if name == "*" || found[name] {
 			continue
 		}
-		newFile := filepath.Join(c.newFilesDir, fmt.Sprintf("%s.Secret.yaml", name))
-		if _, exists := c.files[newFile]; exists {
-			log.Fatalf("new file %s would conflict with existing file", newFile)
+		found[name] = true
+		obj := newObj(name)
+		if c.create(obj) {
+			s.objs = append(s.objs, obj)
+		}
+	}
+	return s
+}
+
+// selectOrCreateIn selects the objects of the kind returned by newObj with the given name in
+// namespace, creating one with newObj if there are none.
+func (c *Cluster) selectOrCreateIn(namespace, name string, newObj func(name string) runtime.Object) *Selection {
+	s := c.Select(Named(name), InNamespace(namespace))
+	kind := reflect.TypeOf(newObj(""))
+	for _, obj := range s.objs {
+		if reflect.TypeOf(obj) == kind {
+			return s
 		}
-		newSecret := Secret(name)
-		c.files[newFile] = newSecret
-		selected = append(selected, newSecret)
 	}
-	return selected
+
+	obj := newObj(name)
+	obj.(Object).SetNamespace(namespace)
+	if c.create(obj) {
+		s.objs = append(s.objs, obj)
+	}
+	return s
+}
+
+// create adds obj to the cluster in the new file ${name}.${Kind}.yaml in newFilesDir, or
+// ${name}.${namespace}.${Kind}.yaml if obj has a namespace, setting its apiVersion and kind. It
+// records a ConflictError and returns false if the file already exists.
+func (c *Cluster) create(obj runtime.Object) bool {
+	gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+	if err != nil {
+		c.errs = append(c.errs, err)
+		return false
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvks[0])
+
+	name := obj.(Object).GetName()
+	if namespace := obj.(Object).GetNamespace(); namespace != "" {
+		name += "." + namespace
+	}
+	newFile := filepath.Join(c.newFilesDir, fmt.Sprintf("%s.%s.yaml", name, gvks[0].Kind))
+	if _, exists := c.files[newFile]; exists {
+		c.errs = append(c.errs, &ConflictError{File: newFile})
+		return false
+	}
+	c.files[newFile] = []*document{{obj: obj}}
+	c.index[obj.(Object)] = newFile
+	c.touch(obj)
+	return true
 }
 
 // sanitize removes fields that shouldn't be present in the persisted YAML files but are emitted by
@@ -249,6 +777,9 @@ func sanitize(m interface{}) {
 		if r, ok := m["resources"].(map[interface{}]interface{}); ok && len(r) == 0 {
 			delete(m, "resources")
 		}
+		if r, ok := m["resources"].(map[string]interface{}); ok && len(r) == 0 {
+			delete(m, "resources")
+		}
 		for _, v := range m {
 			sanitize(v)
 		}
@@ -0,0 +1,1226 @@
+package kg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// writeTestFiles writes files (a map from name to contents) to a new temporary directory and
+// returns the directory and the paths of the written files.
+func writeTestFiles(t *testing.T, files map[string]string) (dir string, paths []string) {
+	dir, err := ioutil.TempDir("", "kg-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return dir, paths
+}
+
+const multiDocumentYAML = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend
+spec:
+  template:
+    spec:
+      containers:
+      - name: frontend
+        image: nginx
+---
+# The Service for the frontend Deployment.
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+spec:
+  ports:
+  - name: http
+    port: 80
+---
+`
+
+func TestClusterMultiDocument(t *testing.T) {
+	dir, paths := writeTestFiles(t, map[string]string{"frontend.Deployment.yaml": multiDocumentYAML})
+	defer os.RemoveAll(dir)
+
+	c, err := NewCluster(paths, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(c.files[paths[0]]); n != 2 {
+		t.Fatalf("expected 2 documents, got %d", n)
+	}
+	if n := len(c.Deployments("frontend").Items); n != 1 {
+		t.Fatalf("expected 1 Deployment, got %d", n)
+	}
+
+	c.Deployments("frontend").Apply(Replicas(3))
+	if err := c.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = NewCluster(paths, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := c.files[paths[0]]
+	if len(docs) != 2 {
+		t.Fatalf("expected 2 documents after Write, got %d", len(docs))
+	}
+	depl, ok := docs[0].obj.(*apps.Deployment)
+	if !ok {
+		t.Fatalf("expected document 0 to be a Deployment, got %T", docs[0].obj)
+	}
+	if depl.Spec.Replicas == nil || *depl.Spec.Replicas != 3 {
+		t.Errorf("expected 3 replicas, got %v", depl.Spec.Replicas)
+	}
+	if _, ok := docs[1].obj.(*core.Service); !ok {
+		t.Errorf("expected document 1 to be a Service, got %T", docs[1].obj)
+	}
+}
+
+func TestClusterPreserveFormatting(t *testing.T) {
+	const before = `# The frontend.
+kind: Deployment
+apiVersion: apps/v1
+metadata:
+  name: frontend
+  annotations:
+    description: 'serves the UI'
+spec:
+  replicas: 1 # scaled up in prod
+  template:
+    spec:
+      containers:
+      - name: frontend
+        image: nginx
+        env:
+        - name: A
+          value: "1"
+        - name: B
+          value: "2" # keep me
+---
+# untouched
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: frontend
+
+data:
+  z: "1"
+  a: "2"
+`
+	const after = `# The frontend.
+kind: Deployment
+apiVersion: apps/v1
+metadata:
+  name: frontend
+  annotations:
+    description: 'serves the UI'
+spec:
+  replicas: 3 # scaled up in prod
+  template:
+    spec:
+      containers:
+      - name: frontend
+        image: nginx
+        env:
+        - name: A
+          value: "10"
+        - name: B
+          value: "2" # keep me
+        - name: C
+          value: "3"
+---
+# untouched
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: frontend
+
+data:
+  z: "1"
+  a: "2"
+`
+	dir, paths := writeTestFiles(t, map[string]string{"frontend.Deployment.yaml": before})
+	defer os.RemoveAll(dir)
+
+	c, err := NewCluster(paths, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetWriteMode(PreserveFormatting)
+	c.Deployments("frontend").Apply(
+		Replicas(3),
+		Pod(Container("frontend", Env(map[string]string{"A": "10", "C": "3"}, true))),
+	)
+	if err := c.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != after {
+		t.Errorf("expected\n%s\nbut got\n%s", after, b)
+	}
+}
+
+// TestClusterPreserveFormattingMissingKeys checks that new keys are inserted correctly when keys
+// the serializer always emits, such as resources: {}, are missing from the source.
+func TestClusterPreserveFormattingMissingKeys(t *testing.T) {
+	const before = `apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: data
+spec:
+  volumeName: pv1
+`
+	const after = `apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: data
+spec:
+  storageClassName: fast
+  volumeName: pv1
+`
+	dir, paths := writeTestFiles(t, map[string]string{"data.PersistentVolumeClaim.yaml": before})
+	defer os.RemoveAll(dir)
+
+	c, err := NewCluster(paths, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetWriteMode(PreserveFormatting)
+	c.PersistentVolumeClaims("data").Apply(func(pvc *core.PersistentVolumeClaim) {
+		storageClass := "fast"
+		pvc.Spec.StorageClassName = &storageClass
+	})
+	if err := c.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != after {
+		t.Errorf("expected\n%s\nbut got\n%s", after, b)
+	}
+}
+
+func TestClusterUnstructured(t *testing.T) {
+	const certificate = `apiVersion: cert-manager.io/v1
+kind: Certificate
+metadata:
+  name: frontend
+spec:
+  dnsNames:
+  - example.com
+  secretName: frontend-tls
+  status: kept
+`
+	dir, paths := writeTestFiles(t, map[string]string{"frontend.Certificate.yaml": certificate})
+	defer os.RemoveAll(dir)
+
+	c, err := NewCluster(paths, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gvk := schema.GroupVersionKind{Group: "cert-manager.io", Kind: "Certificate"}
+	if n := len(c.Unstructured(gvk, "*").Items); n != 1 {
+		t.Fatalf("expected 1 Certificate, got %d", n)
+	}
+	c.Unstructured(gvk, "frontend").Apply(
+		SetField([]string{"example.com", "www.example.com"}, "spec", "dnsNames"),
+		SetField("letsencrypt", "spec", "issuerRef", "name"),
+	)
+	if err := c.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	const exp = `apiVersion: cert-manager.io/v1
+kind: Certificate
+metadata:
+  name: frontend
+spec:
+  dnsNames:
+  - example.com
+  - www.example.com
+  issuerRef:
+    name: letsencrypt
+  secretName: frontend-tls
+  status: kept
+`
+	if string(b) != exp {
+		t.Errorf("expected\n%s\nbut got\n%s", exp, b)
+	}
+}
+
+func TestDryRunCluster(t *testing.T) {
+	dir, paths := writeTestFiles(t, map[string]string{"frontend.Deployment.yaml": multiDocumentYAML})
+	defer os.RemoveAll(dir)
+	newFilesDir := filepath.Join(dir, "new")
+
+	d, err := DryRunCluster(dir, newFilesDir, func(c *Cluster) {
+		c.SetWriteMode(PreserveFormatting)
+		c.Deployments("frontend").Apply(Replicas(2))
+		c.EnsureSecrets("frontend")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newFile := filepath.Join(newFilesDir, "frontend.Secret.yaml")
+	if len(d.Created) != 1 || d.Created[0] != newFile {
+		t.Errorf("expected %s to be created, got %v", newFile, d.Created)
+	}
+	if len(d.Files) != 2 {
+		t.Errorf("expected diffs for 2 files, got %d:\n%s", len(d.Files), d)
+	}
+	const exp = `@@ -3,6 +3,7 @@
+ metadata:
+   name: frontend
+ spec:
++  replicas: 2
+   template:
+     spec:
+       containers:
+`
+	if diff := d.Files[paths[0]]; !strings.Contains(diff, exp) {
+		t.Errorf("expected diff containing\n%s\nbut got\n%s", exp, diff)
+	}
+
+	b, err := ioutil.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != multiDocumentYAML {
+		t.Errorf("expected DryRunCluster not to modify %s", paths[0])
+	}
+	if _, err := os.Stat(newFile); !os.IsNotExist(err) {
+		t.Errorf("expected DryRunCluster not to create %s", newFile)
+	}
+}
+
+func TestClusterWriteUnchanged(t *testing.T) {
+	const unformatted = `kind: ConfigMap
+apiVersion: v1
+metadata: {name: frontend}
+data:
+  a: "1"
+`
+	dir, paths := writeTestFiles(t, map[string]string{
+		"frontend.ConfigMap.yaml": unformatted,
+		"backend.ConfigMap.yaml":  strings.Replace(unformatted, "frontend", "backend", 1),
+	})
+	defer os.RemoveAll(dir)
+
+	c, err := NewCluster(paths, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.ConfigMaps("*").Apply(ConfigMapData(map[string]string{"a": "1"}))
+	c.ConfigMaps("backend").Apply(ConfigMapData(map[string]string{"b": "2"}))
+	if err := c.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	backend := filepath.Join(dir, "backend.ConfigMap.yaml")
+	if modified := c.Modified(); len(modified) != 1 || modified[0] != backend {
+		t.Errorf("expected only %s to be modified, got %v", backend, modified)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "frontend.ConfigMap.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != unformatted {
+		t.Errorf("expected unchanged file to be left untouched, got\n%s", b)
+	}
+
+	// Written and created objects are unchanged until they are modified again
+	c.EnsureConfigMaps("cache")
+	if err := c.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if modified := c.Modified(); len(modified) != 0 {
+		t.Errorf("expected the second write to modify nothing, got %v", modified)
+	}
+}
+
+func TestClusterSelect(t *testing.T) {
+	const objects = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+  namespace: prod
+  labels:
+    tier: backend
+---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: db
+  namespace: prod
+  labels:
+    tier: backend
+  annotations:
+    owner: data
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: prod
+  labels:
+    tier: frontend
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+  namespace: staging
+  labels:
+    tier: backend
+`
+	dir, paths := writeTestFiles(t, map[string]string{"all.Deployment.yaml": objects})
+	defer os.RemoveAll(dir)
+
+	c, err := NewCluster(paths, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		filters      []Filter
+		deployments  int
+		statefulSets int
+	}{
+		{filters: nil, deployments: 3, statefulSets: 1},
+		{filters: []Filter{WithLabels("tier=backend")}, deployments: 2, statefulSets: 1},
+		{filters: []Filter{WithLabels("tier in (backend,frontend)"), InNamespace("prod")}, deployments: 2, statefulSets: 1},
+		{filters: []Filter{WithLabelSelector(&metav1.LabelSelector{MatchLabels: map[string]string{"tier": "frontend"}})}, deployments: 1},
+		{filters: []Filter{WithAnnotation("owner", "data")}, statefulSets: 1},
+		{filters: []Filter{Named("api"), InNamespace("staging")}, deployments: 1},
+	}
+	for i, test := range tests {
+		s := c.Select(test.filters...)
+		if n := len(s.Deployments().Items); n != test.deployments {
+			t.Errorf("test %d: expected %d Deployments, got %d", i, test.deployments, n)
+		}
+		if n := len(s.StatefulSets().Items); n != test.statefulSets {
+			t.Errorf("test %d: expected %d StatefulSets, got %d", i, test.statefulSets, n)
+		}
+	}
+}
+
+func TestModifyClusterOpErrors(t *testing.T) {
+	const pvc = `apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: data
+`
+	dir, _ := writeTestFiles(t, map[string]string{
+		"frontend.Deployment.yaml":        multiDocumentYAML,
+		"data.PersistentVolumeClaim.yaml": pvc,
+	})
+	defer os.RemoveAll(dir)
+	pvcFile := filepath.Join(dir, "data.PersistentVolumeClaim.yaml")
+	deploymentFile := filepath.Join(dir, "frontend.Deployment.yaml")
+
+	err := ModifyCluster(dir, dir, func(c *Cluster) {
+		c.PersistentVolumeClaims("data").Apply(DiskSize("10Gx"))
+		c.Deployments("frontend").Apply(
+			Replicas(2),
+			Pod(Container("frontend", ResourceRequests("1", "lots"))),
+		)
+		c.Select(WithLabels("tier in (")).Deployments().Apply(Replicas(5))
+		PodSpec(Container("backup", ResourceRequests("1x", "1Gi")))
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, exp := range []string{
+		pvcFile + `: PersistentVolumeClaim data: DiskSize("10Gx"): `,
+		deploymentFile + `: Deployment frontend: ResourceRequests("1", "lots"): memory: `,
+		`WithLabels("tier in ("): `,
+		`ResourceRequests("1x", "1Gi"): cpu: `,
+	} {
+		if !strings.Contains(err.Error(), exp) {
+			t.Errorf("expected error to contain %q, got %q", exp, err)
+		}
+	}
+
+	b, err := ioutil.ReadFile(deploymentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != multiDocumentYAML {
+		t.Errorf("expected %s not to be written", deploymentFile)
+	}
+}
+
+func TestOpErrorsOutsideCluster(t *testing.T) {
+	pvc := &core.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "data"}}
+	defer func() {
+		err, ok := recover().(*OpError)
+		if !ok || err.Name != "data" || err.Op != `DiskSize("10Gx")` {
+			t.Errorf("expected Apply to panic with an *OpError, got %v", err)
+		}
+	}()
+	PersistentVolumeClaims{Items: []*core.PersistentVolumeClaim{pvc}}.Apply(DiskSize("10Gx"))
+}
+
+func TestOpErrorsPerCluster(t *testing.T) {
+	const pvc = `apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: data
+`
+	dir, paths := writeTestFiles(t, map[string]string{"data.PersistentVolumeClaim.yaml": pvc})
+	defer os.RemoveAll(dir)
+
+	a, err := NewCluster(paths, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewCluster(paths, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pvcs := a.PersistentVolumeClaims("data")
+	a.Delete(pvcs.Items[0])
+	pvcs.Apply(DiskSize("10Gx"))
+
+	if err := a.Err(); err == nil || !strings.Contains(err.Error(), paths[0]+`: PersistentVolumeClaim data: DiskSize("10Gx")`) {
+		t.Errorf("expected the failure on a deleted object to be recorded, got %v", err)
+	}
+	if err := b.Err(); err != nil {
+		t.Errorf("expected no errors on another cluster, got %v", err)
+	}
+}
+
+func TestClusterEnsure(t *testing.T) {
+	const website = `apiVersion: v1
+kind: Service
+metadata:
+  name: website
+`
+	dir, _ := writeTestFiles(t, map[string]string{
+		"frontend.Deployment.yaml": multiDocumentYAML,
+		"web.Service.yaml":         website,
+	})
+	defer os.RemoveAll(dir)
+
+	c, err := loadCluster(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(c.ConfigMaps("frontend").Items); n != 0 {
+		t.Fatalf("expected ConfigMaps to select nothing, got %d", n)
+	}
+	if n := len(c.ExistingSecrets("frontend").Items); n != 0 {
+		t.Fatalf("expected ExistingSecrets to select nothing, got %d", n)
+	}
+	if _, ok := c.files[filepath.Join(dir, "frontend.Secret.yaml")]; ok {
+		t.Fatal("expected ExistingSecrets not to create frontend.Secret.yaml")
+	}
+	if n := len(c.Secrets("frontend").Items); n != 1 {
+		t.Fatalf("expected 1 Secret, got %d", n)
+	}
+	if _, ok := c.files[filepath.Join(dir, "frontend.Secret.yaml")]; !ok {
+		t.Fatal("expected Secrets to create frontend.Secret.yaml")
+	}
+	if n := len(c.EnsureDeployments("frontend", "backend").Items); n != 2 {
+		t.Fatalf("expected 2 Deployments, got %d", n)
+	}
+	if n := len(c.EnsureConfigMaps("frontend").Items); n != 1 {
+		t.Fatalf("expected 1 ConfigMap, got %d", n)
+	}
+
+	newFile := filepath.Join(dir, "backend.Deployment.yaml")
+	docs := c.files[newFile]
+	if len(docs) != 1 {
+		t.Fatalf("expected %s to be created", newFile)
+	}
+	if gvk := docs[0].obj.GetObjectKind().GroupVersionKind(); gvk != apps.SchemeGroupVersion.WithKind("Deployment") {
+		t.Errorf("expected created object to have kind apps/v1 Deployment, got %v", gvk)
+	}
+	if err := c.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The Service named web would be written to web.Service.yaml, which holds the Service website
+	if n := len(c.EnsureServices("web").Items); n != 0 {
+		t.Errorf("expected no Service to be created, got %d", n)
+	}
+	if err := c.Err(); err == nil || !strings.Contains(err.Error(), "would conflict with existing file") {
+		t.Errorf("expected a conflict error, got %v", err)
+	}
+}
+
+func TestClusterPruneKeepsChanged(t *testing.T) {
+	const deployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: %s
+spec:
+  template:
+    spec:
+      containers:
+      - name: %[1]s
+        image: %s
+`
+	dir, _ := writeTestFiles(t, map[string]string{
+		"frontend.Deployment.yaml": fmt.Sprintf(deployment, "frontend", "nginx"),
+		"backend.Deployment.yaml":  fmt.Sprintf(deployment, "backend", "registry.example.com/backend:1"),
+		"old.Deployment.yaml":      fmt.Sprintf(deployment, "old", "old:1"),
+	})
+	defer os.RemoveAll(dir)
+
+	c, err := loadCluster(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Select(Named("frontend")).SetNamespace("prod")
+	c.RewriteRegistry("registry.example.com", "mirror.example.com")
+	c.Prune()
+
+	d, err := c.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{filepath.Join(dir, "old.Deployment.yaml")}; !reflect.DeepEqual(d.Deleted, exp) {
+		t.Errorf("expected only %v to be deleted, got %v", exp, d.Deleted)
+	}
+}
+
+func TestClusterDelete(t *testing.T) {
+	const config = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: frontend
+`
+	dir, _ := writeTestFiles(t, map[string]string{
+		"frontend.Deployment.yaml": multiDocumentYAML,
+		"frontend.ConfigMap.yaml":  config,
+	})
+	defer os.RemoveAll(dir)
+
+	c, err := loadCluster(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Select(Named("frontend"), OfKind("Service")).Delete()
+	c.Deployments("frontend")
+	c.Prune()
+
+	if n := len(c.Select().Services().Items); n != 0 {
+		t.Errorf("expected deleted Service not to be selected, got %d", n)
+	}
+	d, err := c.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(dir, "frontend.ConfigMap.yaml")
+	if len(d.Deleted) != 1 || d.Deleted[0] != configFile {
+		t.Errorf("expected %s to be deleted, got %v", configFile, d.Deleted)
+	}
+
+	if err := c.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(configFile); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed, got %v", configFile, err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "frontend.Deployment.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "kind: Service") || !strings.Contains(string(b), "kind: Deployment") {
+		t.Errorf("expected only the Deployment to remain, got:\n%s", b)
+	}
+
+	// Writing again must not try to remove the file again
+	if err := c.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if modified := c.Modified(); len(modified) != 0 {
+		t.Errorf("expected the second Write to modify nothing, got %v", modified)
+	}
+}
+
+func TestClusterWorkloads(t *testing.T) {
+	const backup = `apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: backup
+spec:
+  schedule: "0 3 * * *"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: backup
+            image: postgres
+`
+	dir, _ := writeTestFiles(t, map[string]string{
+		"frontend.Deployment.yaml": multiDocumentYAML,
+		"backup.CronJob.yaml":      backup,
+	})
+	defer os.RemoveAll(dir)
+
+	c, err := loadCluster(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	workloads := c.Workloads()
+	if len(workloads.Items) != 2 {
+		t.Fatalf("expected 2 workloads, got %d", len(workloads.Items))
+	}
+	workloads.Apply(WorkloadPod(Container("proxy", Args("--port=8080"))), PodLabels(map[string]string{"mesh": "true"}))
+
+	cronJob := c.CronJobs("backup").Items[0]
+	template := cronJob.Spec.JobTemplate.Spec.Template
+	if n := len(template.Spec.Containers); n != 2 {
+		t.Errorf("expected the proxy container to be added to the CronJob, got %d containers", n)
+	}
+	if template.Labels["mesh"] != "true" {
+		t.Errorf("expected the CronJob pod template to be labeled, got %v", template.Labels)
+	}
+	if n := len(c.Deployments("frontend").Items[0].Spec.Template.Spec.Containers); n != 2 {
+		t.Errorf("expected the proxy container to be added to the Deployment, got %d containers", n)
+	}
+}
+
+func TestClusterJobs(t *testing.T) {
+	dir, _ := writeTestFiles(t, map[string]string{"frontend.Deployment.yaml": multiDocumentYAML})
+	defer os.RemoveAll(dir)
+
+	c, err := loadCluster(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(c.Jobs("migrate").Items) + len(c.CronJobs("backup").Items); n != 0 {
+		t.Fatalf("expected Jobs and CronJobs to select nothing, got %d", n)
+	}
+	jobs := c.EnsureJobs("migrate")
+	jobs.Apply(JobSpec(BackoffLimit(0), ActiveDeadlineSeconds(300), JobPod(Container("migrate", Image("app:1")))))
+	cronJobs := c.EnsureCronJobs("backup")
+	cronJobs.Apply(
+		Schedule("@every 12h"),
+		ConcurrencyPolicy(batch.ForbidConcurrent),
+		HistoryLimits(3, 1),
+		JobTemplate(BackoffLimit(2), JobPod(Container("backup", Image("postgres:16")))),
+	)
+	if err := c.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{"migrate.Job.yaml", "backup.CronJob.yaml"} {
+		if _, ok := c.files[filepath.Join(dir, file)]; !ok {
+			t.Errorf("expected %s to be created", file)
+		}
+	}
+	job := jobs.Items[0]
+	if *job.Spec.BackoffLimit != 0 || *job.Spec.ActiveDeadlineSeconds != 300 {
+		t.Errorf("expected backoffLimit 0 and activeDeadlineSeconds 300, got %+v", job.Spec)
+	}
+	if pod := job.Spec.Template.Spec; pod.RestartPolicy != core.RestartPolicyNever || len(pod.Containers) != 1 {
+		t.Errorf("expected 1 container that is never restarted, got %+v", pod)
+	}
+	cronJob := cronJobs.Items[0]
+	if spec := cronJob.Spec; spec.Schedule != "@every 12h" || spec.ConcurrencyPolicy != batch.ForbidConcurrent ||
+		*spec.SuccessfulJobsHistoryLimit != 3 || *spec.FailedJobsHistoryLimit != 1 {
+		t.Errorf("unexpected CronJob spec %+v", spec)
+	}
+	if spec := cronJob.Spec.JobTemplate.Spec; *spec.BackoffLimit != 2 || spec.Template.Spec.Containers[0].Image != "postgres:16" {
+		t.Errorf("unexpected job template %+v", spec)
+	}
+	if n := len(c.Jobs("migrate").Items) + len(c.CronJobs("backup").Items); n != 2 {
+		t.Errorf("expected the created Job and CronJob to be selected, got %d", n)
+	}
+
+	cronJobs.Apply(ConcurrencyPolicy("Sometimes"))
+	if err := c.Err(); err == nil || !strings.Contains(err.Error(), `ConcurrencyPolicy("Sometimes")`) {
+		t.Errorf("expected ConcurrencyPolicy to fail, got %v", err)
+	}
+}
+
+func TestClusterProtectWorkload(t *testing.T) {
+	dir, _ := writeTestFiles(t, nil)
+	defer os.RemoveAll(dir)
+
+	c, err := loadCluster(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, namespace := range []string{"prod", "staging", "prod"} {
+		deploy := &apps.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: namespace}}
+		deploy.Spec.Template.Labels = map[string]string{"app": "api", "env": namespace}
+		w, _ := workload(deploy)
+		c.ProtectWorkload(w)
+	}
+	if err := c.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(c.Select(OfKind("PodDisruptionBudget")).PodDisruptionBudgets().Items); n != 2 {
+		t.Errorf("expected one budget per namespace, got %d budgets", n)
+	}
+	for _, namespace := range []string{"prod", "staging"} {
+		docs := c.files[filepath.Join(dir, "api."+namespace+".PodDisruptionBudget.yaml")]
+		if len(docs) != 1 {
+			t.Fatalf("expected api.%s.PodDisruptionBudget.yaml to be created", namespace)
+		}
+		pdb := docs[0].obj.(*policy.PodDisruptionBudget)
+		if exp := map[string]string{"app": "api", "env": namespace}; pdb.Namespace != namespace || !reflect.DeepEqual(pdb.Spec.Selector.MatchLabels, exp) {
+			t.Errorf("expected a budget in %s selecting %v, got one in %q selecting %v", namespace, exp, pdb.Namespace, pdb.Spec.Selector.MatchLabels)
+		}
+	}
+
+	// A budget for a workload whose pods have no labels could only select every pod
+	w, _ := workload(&apps.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "frontend"}})
+	c.ProtectWorkload(w)
+	if err := c.Err(); err == nil || !strings.Contains(err.Error(), "ProtectWorkload(frontend): pod template has no labels") {
+		t.Errorf("expected ProtectWorkload to fail for a workload without labels, got %v", err)
+	}
+}
+
+func TestClusterAutoscale(t *testing.T) {
+	dir, _ := writeTestFiles(t, map[string]string{"frontend.Deployment.yaml": multiDocumentYAML})
+	defer os.RemoveAll(dir)
+
+	c, err := loadCluster(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployments := c.Deployments("frontend")
+	deployments.Apply(Replicas(3))
+	hpas := c.Autoscale(deployments.Items[0], 2, 10)
+	hpas.Apply(CPUUtilization(60), CPUUtilization(75))
+	deployments.Apply(RemoveReplicas())
+	if err := c.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hpas.Items) != 1 {
+		t.Fatalf("expected 1 HorizontalPodAutoscaler, got %d", len(hpas.Items))
+	}
+	ref := hpas.Items[0].Spec.ScaleTargetRef
+	if ref.APIVersion != "apps/v1" || ref.Kind != "Deployment" || ref.Name != "frontend" {
+		t.Errorf("expected scale target apps/v1 Deployment frontend, got %+v", ref)
+	}
+	if n := len(hpas.Items[0].Spec.Metrics); n != 1 {
+		t.Errorf("expected the CPU metric to be replaced, got %d metrics", n)
+	}
+	if deployments.Items[0].Spec.Replicas != nil {
+		t.Errorf("expected replicas to be removed, got %d", *deployments.Items[0].Spec.Replicas)
+	}
+	if _, ok := c.files[filepath.Join(dir, "frontend.HorizontalPodAutoscaler.yaml")]; !ok {
+		t.Error("expected frontend.HorizontalPodAutoscaler.yaml to be created")
+	}
+}
+
+func TestClusterAutoscaleNamespaces(t *testing.T) {
+	dir, _ := writeTestFiles(t, nil)
+	defer os.RemoveAll(dir)
+
+	c, err := loadCluster(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, namespace := range []string{"prod", "staging"} {
+		target := &apps.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: namespace}}
+		hpas := c.Autoscale(target, 1, 3)
+		if len(hpas.Items) != 1 || hpas.Items[0].Namespace != namespace {
+			t.Errorf("expected 1 HorizontalPodAutoscaler in %s, got %d", namespace, len(hpas.Items))
+		}
+		if _, ok := c.files[filepath.Join(dir, "api."+namespace+".HorizontalPodAutoscaler.yaml")]; !ok {
+			t.Errorf("expected api.%s.HorizontalPodAutoscaler.yaml to be created", namespace)
+		}
+	}
+}
+
+func TestClusterNetworkPolicies(t *testing.T) {
+	const backend = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: backend
+spec:
+  template:
+    metadata:
+      labels:
+        app: backend
+    spec:
+      containers:
+      - name: backend
+        image: nginx
+        ports:
+        - name: http
+          containerPort: 8080
+`
+	dir, _ := writeTestFiles(t, map[string]string{
+		"frontend.Deployment.yaml": strings.Replace(multiDocumentYAML, "  template:\n", "  template:\n    metadata:\n      labels:\n        app: frontend\n", 1),
+		"backend.Deployment.yaml":  backend,
+	})
+	defer os.RemoveAll(dir)
+
+	c, err := loadCluster(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(c.DefaultDeny("prod", "staging").Items); n != 2 {
+		t.Errorf("expected 2 default-deny policies, got %d", n)
+	}
+	if _, ok := c.files[filepath.Join(dir, "default-deny.prod.NetworkPolicy.yaml")]; !ok {
+		t.Error("expected default-deny.prod.NetworkPolicy.yaml to be created")
+	}
+
+	frontend, backendWorkload := c.Workloads(Named("frontend")).Items[0], c.Workloads(Named("backend")).Items[0]
+	c.AllowIngress(backendWorkload, frontend)
+	nps := c.AllowIngress(backendWorkload, frontend)
+	if err := c.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(nps.Items) != 1 {
+		t.Fatalf("expected 1 NetworkPolicy, got %d", len(nps.Items))
+	}
+	spec := nps.Items[0].Spec
+	if spec.PodSelector.MatchLabels["app"] != "backend" {
+		t.Errorf("expected the policy to select the backend pods, got %v", spec.PodSelector)
+	}
+	if len(spec.Ingress) != 1 {
+		t.Fatalf("expected 1 ingress rule, got %d", len(spec.Ingress))
+	}
+	rule := spec.Ingress[0]
+	if rule.From[0].PodSelector.MatchLabels["app"] != "frontend" || len(rule.Ports) != 1 || rule.Ports[0].Port.StrVal != "http" {
+		t.Errorf("expected a rule allowing frontend to port http, got %+v", rule)
+	}
+}
+
+func TestClusterNetworkPoliciesWithoutLabels(t *testing.T) {
+	dir, _ := writeTestFiles(t, map[string]string{"frontend.Deployment.yaml": multiDocumentYAML})
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name  string
+		apply func(c *Cluster, frontend, backend Workload)
+		op    string
+	}{
+		{"PolicyPods", func(c *Cluster, frontend, backend Workload) {
+			c.EnsureNetworkPolicies("frontend").Apply(PolicyPods(frontend))
+		}, "PolicyPods(frontend)"},
+		{"AllowIngressFrom", func(c *Cluster, frontend, backend Workload) {
+			c.EnsureNetworkPolicies("backend").Apply(PolicyPods(backend), AllowIngressFrom(frontend, "http"))
+		}, "AllowIngressFrom(frontend)"},
+		{"AllowEgressTo", func(c *Cluster, frontend, backend Workload) {
+			c.EnsureNetworkPolicies("backend").Apply(PolicyPods(backend), AllowEgressTo(frontend))
+		}, "AllowEgressTo(frontend)"},
+		{"AllowIngress", func(c *Cluster, frontend, backend Workload) {
+			c.AllowIngress(frontend, backend)
+		}, "PolicyPods(frontend)"},
+		{"AllowEgress", func(c *Cluster, frontend, backend Workload) {
+			c.AllowEgress(backend, frontend)
+		}, "AllowEgressTo(frontend)"},
+	}
+	for _, test := range tests {
+		c, err := loadCluster(dir, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.EnsureDeployments("backend")
+		frontend, backend := c.Workloads(Named("frontend")).Items[0], c.Workloads(Named("backend")).Items[0]
+
+		// An empty pod selector would select every pod in the namespace
+		test.apply(c, frontend, backend)
+		if err := c.Err(); err == nil || !strings.Contains(err.Error(), test.op+": pod template of frontend has no labels") {
+			t.Errorf("%s: expected %s to fail, got %v", test.name, test.op, err)
+		}
+	}
+}
+
+func TestClusterSetNamespace(t *testing.T) {
+	dir, _ := writeTestFiles(t, map[string]string{"frontend.Deployment.yaml": multiDocumentYAML})
+	defer os.RemoveAll(dir)
+
+	c, err := loadCluster(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Select(c.InDirectory(dir)).SetNamespace("web")
+	if n := len(c.Select(InNamespace("web")).objs); n != 2 {
+		t.Errorf("expected 2 objects in namespace web, got %d", n)
+	}
+	if n := len(c.Namespaces("web").Items); n != 1 {
+		t.Errorf("expected Namespace web to be created, got %d", n)
+	}
+	if n := len(c.Select(c.InDirectory(filepath.Join(dir, "other"))).objs); n != 0 {
+		t.Errorf("expected no objects in other directory, got %d", n)
+	}
+}
+
+func TestClusterSetNamespaceScope(t *testing.T) {
+	const clusterScoped = `apiVersion: node.k8s.io/v1
+kind: RuntimeClass
+metadata:
+  name: gvisor
+handler: runsc
+---
+apiVersion: scheduling.k8s.io/v1
+kind: PriorityClass
+metadata:
+  name: high
+value: 1000
+---
+apiVersion: storage.k8s.io/v1
+kind: CSIDriver
+metadata:
+  name: csi.example.com
+`
+	const certManager = `apiVersion: cert-manager.io/v1
+kind: ClusterIssuer
+metadata:
+  name: letsencrypt
+---
+apiVersion: cert-manager.io/v1
+kind: Certificate
+metadata:
+  name: web
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: gadget
+`
+	const crds = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: clusterissuers.cert-manager.io
+spec:
+  group: cert-manager.io
+  scope: Cluster
+  names:
+    kind: ClusterIssuer
+    plural: clusterissuers
+  versions:
+  - name: v1
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: certificates.cert-manager.io
+spec:
+  group: cert-manager.io
+  scope: Namespaced
+  names:
+    kind: Certificate
+    plural: certificates
+  versions:
+  - name: v1
+`
+	namespaces := func(c *Cluster) map[string]string {
+		m := make(map[string]string)
+		for _, obj := range c.objects() {
+			m[obj.GetObjectKind().GroupVersionKind().Kind] = obj.(Object).GetNamespace()
+		}
+		return m
+	}
+
+	dir, _ := writeTestFiles(t, map[string]string{
+		"node.RuntimeClass.yaml":         clusterScoped,
+		"letsencrypt.ClusterIssuer.yaml": certManager,
+	})
+	defer os.RemoveAll(dir)
+	c, err := loadCluster(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Select(c.InDirectory(dir)).SetNamespace("web")
+	// The scope of the custom resources is unknown, so they are left alone
+	exp := map[string]string{"RuntimeClass": "", "PriorityClass": "", "CSIDriver": "", "ClusterIssuer": "", "Certificate": "", "Widget": "", "Namespace": ""}
+	if got := namespaces(c); !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected namespaces %v, got %v", exp, got)
+	}
+
+	// The CustomResourceDefinitions declare the scope of cert-manager's resources
+	if err := ioutil.WriteFile(filepath.Join(dir, "cert-manager.CustomResourceDefinition.yaml"), []byte(crds), 0666); err != nil {
+		t.Fatal(err)
+	}
+	c, err = loadCluster(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapper := DefaultRESTMapper()
+	mapper.Add(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}, meta.RESTScopeNamespace)
+	c.SetRESTMapper(mapper)
+	c.Select(c.InDirectory(dir)).SetNamespace("web")
+	exp = map[string]string{"RuntimeClass": "", "PriorityClass": "", "CSIDriver": "", "ClusterIssuer": "", "Certificate": "web", "Widget": "web", "CustomResourceDefinition": "", "Namespace": ""}
+	if got := namespaces(c); !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected namespaces %v, got %v", exp, got)
+	}
+}
+
+func TestClusterRewriteRegistry(t *testing.T) {
+	dir, _ := writeTestFiles(t, map[string]string{"frontend.Deployment.yaml": multiDocumentYAML})
+	defer os.RemoveAll(dir)
+
+	c, err := loadCluster(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Deployments("frontend").Apply(Pod(
+		Container("frontend", ImageTag("1.21")),
+		func(pod *core.PodSpec) {
+			pod.InitContainers = append(pod.InitContainers, core.Container{Name: "migrate", Image: "gcr.io/project/migrate:v1"})
+		},
+	))
+	changes := c.RewriteRegistry("docker.io/*", "mirror.internal/*")
+	if err := c.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := []ImageChange{{Kind: "Deployment", Name: "frontend", Container: "frontend", From: "nginx:1.21", To: "mirror.internal/library/nginx:1.21"}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("expected changes %+v, got %+v", want, changes)
+	}
+
+	if changes := c.RewriteRegistry("gcr.io/project", "mirror.internal/gcr"); len(changes) != 1 || changes[0].To != "mirror.internal/gcr/migrate:v1" {
+		t.Errorf("expected the init container to be rewritten, got %+v", changes)
+	}
+
+	// A container without an image, or with an image that is not rewritten, does not need to be
+	// valid
+	c.Deployments("frontend").Apply(Pod(
+		Container("proxy", Args("--port=8080")),
+		Container("sidecar", func(pod *core.PodSpec, container *core.Container) { container.Image = "quay.io/Bad/Image" }),
+	))
+	if changes := c.RewriteRegistry("mirror.internal/library", "docker.io/library"); len(changes) != 1 {
+		t.Errorf("expected the frontend container to be rewritten, got %+v", changes)
+	}
+	if err := c.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// If an image cannot be rewritten, neither are the others
+	c.Deployments("frontend").Apply(Pod(Container("cache", func(pod *core.PodSpec, container *core.Container) {
+		container.Image = "docker.io/Redis"
+	})))
+	if changes := c.RewriteRegistry("docker.io/*", "mirror.internal/*"); len(changes) != 0 {
+		t.Errorf("expected nothing to be rewritten, got %+v", changes)
+	}
+	if err := c.Err(); err == nil || !strings.Contains(err.Error(), "container cache") {
+		t.Errorf("expected the invalid image to fail, got %v", err)
+	}
+	if image := c.Deployments("frontend").Items[0].Spec.Template.Spec.Containers[0].Image; image != "docker.io/library/nginx:1.21" {
+		t.Errorf("expected the frontend container to be left unchanged, got %s", image)
+	}
+}
+
+func TestReadImageLock(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	dir, paths := writeTestFiles(t, map[string]string{
+		"images.lock.yaml":  "nginx:1.21: " + digest + "\ngcr.io/project/app:v1: " + digest + "\n",
+		"images.lock.json":  `{"nginx:1.21": "` + digest + `"}`,
+		"invalid.lock.yaml": "- nginx\n",
+	})
+	defer os.RemoveAll(dir)
+
+	for _, path := range paths {
+		lock, err := ReadImageLock(path)
+		if filepath.Base(path) == "invalid.lock.yaml" {
+			if err == nil {
+				t.Errorf("%s: expected an error", path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lock["nginx:1.21"] != digest {
+			t.Errorf("%s: expected nginx:1.21 to map to %s, got %v", path, digest, lock)
+		}
+	}
+}
+
+func TestClusterPinImages(t *testing.T) {
+	dir, _ := writeTestFiles(t, map[string]string{"frontend.Deployment.yaml": multiDocumentYAML})
+	defer os.RemoveAll(dir)
+
+	c, err := loadCluster(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := "sha256:" + strings.Repeat("a", 64)
+	newDigest := "sha256:" + strings.Repeat("b", 64)
+	changes := c.PinImages(map[string]string{"docker.io/library/nginx:latest": digest})
+	if err := c.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].To != "nginx@"+digest {
+		t.Fatalf("expected nginx to be pinned, got %+v", changes)
+	}
+
+	// Pinning again repins from the annotation
+	changes = c.PinImages(map[string]string{"nginx": newDigest})
+	deployment := c.Deployments("frontend").Items[0]
+	if len(changes) != 1 || deployment.Spec.Template.Spec.Containers[0].Image != "nginx@"+newDigest {
+		t.Errorf("expected nginx to be repinned, got %+v", changes)
+	}
+	if image := deployment.Annotations["image.kg.sourcegraph.com/frontend"]; image != "nginx@"+newDigest {
+		t.Errorf("expected the original image and its digest in an annotation, got %q", image)
+	}
+
+	// A digest set explicitly since the image was pinned takes precedence over the annotation
+	explicitDigest := "sha256:" + strings.Repeat("c", 64)
+	c.Deployments("frontend").Apply(Pod(Container("frontend", ImageDigest(explicitDigest))))
+	if changes := c.PinImages(map[string]string{"nginx": digest}); len(changes) != 0 {
+		t.Errorf("expected the explicit digest to be kept, got %+v", changes)
+	}
+	if image := deployment.Spec.Template.Spec.Containers[0].Image; image != "nginx@"+explicitDigest {
+		t.Errorf("expected image nginx@%s, got %s", explicitDigest, image)
+	}
+	if _, ok := deployment.Annotations["image.kg.sourcegraph.com/frontend"]; ok {
+		t.Error("expected the stale annotation to be removed")
+	}
+
+	// Containers without an image are skipped
+	c.Deployments("frontend").Apply(Pod(Container("sidecar")))
+	c.PinImages(map[string]string{"nginx": digest})
+	if err := c.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Deployments("frontend").Apply(Pod(Container("frontend", Image("nginx:1.21"))))
+	c.PinImages(map[string]string{"nginx": digest})
+	if err := c.Err(); err == nil || !strings.Contains(err.Error(), "images missing from lockfile: nginx:1.21") {
+		t.Errorf("expected a missing image error, got %v", err)
+	}
+}
@@ -2,10 +2,19 @@ package kg
 
 import (
 	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 type ConfigMapOp func(cm *core.ConfigMap)
 
+func ConfigMap(name string) *core.ConfigMap {
+	return &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+	}
+}
+
 func ConfigMapData(data map[string]string) ConfigMapOp {
 	return func(cm *core.ConfigMap) {
 		if cm.Data == nil {
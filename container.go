@@ -1,6 +1,8 @@
 package kg
 
 import (
+	"fmt"
+	"regexp"
 	"sort"
 
 	kube "k8s.io/api/core/v1"
@@ -21,13 +23,23 @@ func Args(args ...string) ContainerOp {
 	}
 }
 
+// Env sets the values of the environment variables in vars that exist, and adds the others if
+// addIfNotExist is true. Existing variables keep their position and new ones are appended in
+// order of name. Use EnvVar for variables whose values reference other variables.
 func Env(vars map[string]string, addIfNotExist bool) ContainerOp {
 	return func(pod *kube.PodSpec, container *kube.Container) {
-		for name, value := range vars {
+		names := make([]string, 0, len(vars))
+		for name := range vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value := vars[name]
 			exists := false
 			for i := range container.Env {
 				if container.Env[i].Name == name {
 					container.Env[i].Value = value
+					container.Env[i].ValueFrom = nil
 					exists = true
 				}
 			}
@@ -36,30 +48,241 @@ func Env(vars map[string]string, addIfNotExist bool) ContainerOp {
 				container.Env = append(container.Env, kube.EnvVar{Name: name, Value: value})
 			}
 		}
-		sort.Sort(byName(container.Env))
 	}
 }
 
-type byName []kube.EnvVar
+// envReference matches an escaped $$ or a $(VAR) reference to another environment variable.
+var envReference = regexp.MustCompile(`\$(\$|\(([^)]*)\))`)
 
-func (a byName) Len() int           { return len(a) }
-func (a byName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a byName) Less(i, j int) bool { return a[i].Name < a[j].Name }
+// EnvVar sets the environment variable name to value, replacing the existing variable of that
+// name in its position or appending it. value may reference variables declared before it with
+// $(VAR). It fails if value references a variable declared after it, which Kubernetes would not
+// expand, or one that is not declared at all unless the container has envFrom sources.
+func EnvVar(name, value string) ContainerOp {
+	return func(pod *kube.PodSpec, container *kube.Container) {
+		// A new variable is appended, so it is declared after all existing ones
+		index := len(container.Env)
+		for i := range container.Env {
+			if container.Env[i].Name == name {
+				index = i
+				break
+			}
+		}
 
-func ResourceRequests(cpu, memory string) ContainerOp {
+		declared := make(map[string]int)
+		for i, v := range container.Env {
+			if _, ok := declared[v.Name]; !ok {
+				declared[v.Name] = i
+			}
+		}
+		if _, ok := declared[name]; !ok {
+			declared[name] = index
+		}
+		for _, match := range envReference.FindAllStringSubmatch(value, -1) {
+			if match[1] == "$" {
+				continue
+			}
+			ref := match[2]
+			i, ok := declared[ref]
+			switch {
+			case ok && i >= index:
+				Fail(fmt.Sprintf("EnvVar(%q, %q)", name, value), fmt.Errorf("$(%s) is declared after %s", ref, name))
+			case !ok && len(container.EnvFrom) == 0:
+				Fail(fmt.Sprintf("EnvVar(%q, %q)", name, value), fmt.Errorf("$(%s) is not declared", ref))
+			}
+		}
+
+		if index == len(container.Env) {
+			container.Env = append(container.Env, kube.EnvVar{Name: name, Value: value})
+		} else {
+			container.Env[index] = kube.EnvVar{Name: name, Value: value}
+		}
+	}
+}
+
+// EnvVarFrom sets the environment variable with the given name to the value from source,
+// replacing the existing variable of that name if there is one.
+func EnvVarFrom(name string, source *kube.EnvVarSource) ContainerOp {
+	return func(pod *kube.PodSpec, container *kube.Container) {
+		for i := range container.Env {
+			if container.Env[i].Name == name {
+				container.Env[i] = kube.EnvVar{Name: name, ValueFrom: source}
+				return
+			}
+		}
+		container.Env = append(container.Env, kube.EnvVar{Name: name, ValueFrom: source})
+	}
+}
+
+func EnvVarFromSecret(varName string, secretName string, secretKey string, optional bool) ContainerOp {
+	return EnvVarFrom(varName, &kube.EnvVarSource{
+		SecretKeyRef: &kube.SecretKeySelector{
+			LocalObjectReference: kube.LocalObjectReference{Name: secretName},
+			Key:                  secretKey,
+			Optional:             BoolPtr(optional),
+		},
+	})
+}
+
+func EnvVarFromFieldSelector(name string, fieldPath string) ContainerOp {
+	return EnvVarFrom(name, &kube.EnvVarSource{
+		FieldRef: &kube.ObjectFieldSelector{FieldPath: fieldPath},
+	})
+}
+
+func EnvVarFromConfigMap(varName string, configMapName string, key string, optional bool) ContainerOp {
+	return EnvVarFrom(varName, &kube.EnvVarSource{
+		ConfigMapKeyRef: &kube.ConfigMapKeySelector{
+			LocalObjectReference: kube.LocalObjectReference{Name: configMapName},
+			Key:                  key,
+			Optional:             BoolPtr(optional),
+		},
+	})
+}
+
+// EnvVarFromResource sets the environment variable to a resource request or limit of a container
+// in the pod, e.g. EnvVarFromResource("GOMAXPROCS", "frontend", "limits.cpu").
+func EnvVarFromResource(varName string, containerName string, resource string) ContainerOp {
+	return EnvVarFrom(varName, &kube.EnvVarSource{
+		ResourceFieldRef: &kube.ResourceFieldSelector{ContainerName: containerName, Resource: resource},
+	})
+}
+
+// RemoveEnv removes the environment variables with the given names, if they exist.
+func RemoveEnv(names ...string) ContainerOp {
 	return func(pod *kube.PodSpec, container *kube.Container) {
-		container.Resources.Requests = kube.ResourceList{
-			kube.ResourceCPU:    resource.MustParse(cpu),
-			kube.ResourceMemory: resource.MustParse(memory),
+		remove := stringSet(names)
+		var kept []kube.EnvVar
+		for _, v := range container.Env {
+			if !remove[v.Name] {
+				kept = append(kept, v)
+			}
 		}
+		container.Env = kept
+	}
+}
+
+// EnvFromConfigMap adds the keys of the named ConfigMap as environment variables, with names
+// prefixed by prefix. The prefix of an existing source for the ConfigMap is replaced.
+func EnvFromConfigMap(name string, prefix string) ContainerOp {
+	return envFrom(kube.EnvFromSource{
+		Prefix:       prefix,
+		ConfigMapRef: &kube.ConfigMapEnvSource{LocalObjectReference: kube.LocalObjectReference{Name: name}},
+	})
+}
+
+// EnvFromSecret adds the keys of the named Secret as environment variables, with names prefixed
+// by prefix. The prefix of an existing source for the Secret is replaced.
+func EnvFromSecret(name string, prefix string) ContainerOp {
+	return envFrom(kube.EnvFromSource{
+		Prefix:    prefix,
+		SecretRef: &kube.SecretEnvSource{LocalObjectReference: kube.LocalObjectReference{Name: name}},
+	})
+}
+
+func envFrom(source kube.EnvFromSource) ContainerOp {
+	return func(pod *kube.PodSpec, container *kube.Container) {
+		for i := range container.EnvFrom {
+			if sameEnvFromSource(container.EnvFrom[i], source) {
+				container.EnvFrom[i].Prefix = source.Prefix
+				return
+			}
+		}
+		container.EnvFrom = append(container.EnvFrom, source)
+	}
+}
+
+// RemoveEnvFrom removes the envFrom sources for the named ConfigMap or Secret, if they exist.
+func RemoveEnvFrom(name string) ContainerOp {
+	return func(pod *kube.PodSpec, container *kube.Container) {
+		var kept []kube.EnvFromSource
+		for _, source := range container.EnvFrom {
+			if envFromName(source) != name {
+				kept = append(kept, source)
+			}
+		}
+		container.EnvFrom = kept
+	}
+}
+
+func sameEnvFromSource(a, b kube.EnvFromSource) bool {
+	return (a.ConfigMapRef != nil) == (b.ConfigMapRef != nil) && envFromName(a) == envFromName(b)
+}
+
+func envFromName(source kube.EnvFromSource) string {
+	switch {
+	case source.ConfigMapRef != nil:
+		return source.ConfigMapRef.Name
+	case source.SecretRef != nil:
+		return source.SecretRef.Name
+	}
+	return ""
+}
+
+func ResourceRequests(cpu, memory string) ContainerOp {
+	return func(pod *kube.PodSpec, container *kube.Container) {
+		container.Resources.Requests = resourceList(fmt.Sprintf("ResourceRequests(%q, %q)", cpu, memory), cpu, memory)
 	}
 }
 
 func ResourceLimits(cpu, memory string) ContainerOp {
 	return func(pod *kube.PodSpec, container *kube.Container) {
-		container.Resources.Limits = kube.ResourceList{
-			kube.ResourceCPU:    resource.MustParse(cpu),
-			kube.ResourceMemory: resource.MustParse(memory),
+		container.Resources.Limits = resourceList(fmt.Sprintf("ResourceLimits(%q, %q)", cpu, memory), cpu, memory)
+	}
+}
+
+// resourceList parses cpu and memory quantities, failing op if either is invalid.
+func resourceList(op, cpu, memory string) kube.ResourceList {
+	cpuQuantity, err := resource.ParseQuantity(cpu)
+	if err != nil {
+		Fail(op, fmt.Errorf("cpu: %v", err))
+	}
+	memoryQuantity, err := resource.ParseQuantity(memory)
+	if err != nil {
+		Fail(op, fmt.Errorf("memory: %v", err))
+	}
+	return kube.ResourceList{
+		kube.ResourceCPU:    cpuQuantity,
+		kube.ResourceMemory: memoryQuantity,
+	}
+}
+
+// ContainerPort adds a TCP port with the given name, or updates the existing port with that name.
+func ContainerPort(name string, port int32) ContainerOp {
+	return ContainerPortWithProtocol(name, port, kube.ProtocolTCP)
+}
+
+// ContainerPortWithProtocol adds a port with the given name and protocol, or updates the existing
+// port with that name.
+func ContainerPortWithProtocol(name string, port int32, protocol kube.Protocol) ContainerOp {
+	return func(pod *kube.PodSpec, container *kube.Container) {
+		var p *kube.ContainerPort
+		for i := range container.Ports {
+			if container.Ports[i].Name == name {
+				p = &container.Ports[i]
+				break
+			}
+		}
+		if p == nil {
+			container.Ports = append(container.Ports, kube.ContainerPort{Name: name})
+			p = &container.Ports[len(container.Ports)-1]
+		}
+		p.ContainerPort = port
+		// An empty protocol is TCP, so it is left empty rather than rewritten
+		if protocol != kube.ProtocolTCP || p.Protocol != "" {
+			p.Protocol = protocol
+		}
+	}
+}
+
+// RemovePort removes the port with the given name, if it exists.
+func RemovePort(name string) ContainerOp {
+	return func(pod *kube.PodSpec, container *kube.Container) {
+		for i := range container.Ports {
+			if container.Ports[i].Name == name {
+				container.Ports = append(container.Ports[:i], container.Ports[i+1:]...)
+				return
+			}
 		}
 	}
 }
@@ -0,0 +1,80 @@
+package kg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	kube "k8s.io/api/core/v1"
+)
+
+func TestContainerOpsIdempotent(t *testing.T) {
+	ops := []PodSpecOp{Container("frontend",
+		ContainerPort("http", 80),
+		ContainerPort("http", 8080),
+		ContainerPortWithProtocol("dns", 53, kube.ProtocolUDP),
+		Env(map[string]string{"MODE": "prod"}, true),
+		EnvVarFromSecret("TOKEN", "frontend", "token", false),
+		EnvVarFromFieldSelector("MODE", "metadata.namespace"),
+	)}
+
+	once := PodSpec(ops...)
+	twice := PodSpec(append(ops, ops...)...)
+	if !reflect.DeepEqual(once, twice) {
+		t.Errorf("expected applying ops twice to be a no-op, got\n%+v\nand\n%+v", once, twice)
+	}
+
+	container := once.Containers[0]
+	if len(container.Ports) != 2 || container.Ports[0].ContainerPort != 8080 {
+		t.Errorf("expected port http to be updated, got %+v", container.Ports)
+	}
+	if len(container.Env) != 2 || container.Env[0].Name != "MODE" || container.Env[0].ValueFrom == nil {
+		t.Errorf("expected MODE to be replaced, got %+v", container.Env)
+	}
+
+	Container("frontend", RemovePort("dns"), RemoveEnv("MODE", "TOKEN"))(once)
+	if container := once.Containers[0]; len(container.Ports) != 1 || len(container.Env) != 0 {
+		t.Errorf("expected port and env vars to be removed, got %+v", container)
+	}
+}
+
+func TestEnvVarOrder(t *testing.T) {
+	tests := []struct {
+		ops []ContainerOp
+		err string
+	}{
+		{ops: []ContainerOp{EnvVar("HOST", "db"), EnvVar("URL", "postgres://$(HOST)/$$(literal)")}},
+		{ops: []ContainerOp{EnvVar("URL", ""), EnvVar("HOST", "db"), EnvVar("URL", "postgres://$(HOST)")}, err: "$(HOST) is declared after URL"},
+		{ops: []ContainerOp{EnvVar("URL", "postgres://$(HOST)")}, err: "$(HOST) is not declared"},
+		{ops: []ContainerOp{EnvFromConfigMap("db", "DB_"), EnvVar("URL", "postgres://$(DB_HOST)")}},
+	}
+	for i, test := range tests {
+		func() {
+			defer func() {
+				err, _ := recover().(*OpError)
+				switch {
+				case test.err == "" && err != nil:
+					t.Errorf("test %d: unexpected error: %v", i, err)
+				case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+					t.Errorf("test %d: expected error %q, got %v", i, test.err, err)
+				}
+			}()
+			PodSpec(Container("app", test.ops...))
+		}()
+	}
+}
+
+func TestEnvVarFailureLeavesEnvUnchanged(t *testing.T) {
+	pod := PodSpec(Container("frontend", EnvVar("HOST", "db")))
+	func() {
+		defer func() {
+			if err, _ := recover().(*OpError); err == nil || !strings.Contains(err.Error(), "$(PORT) is not declared") {
+				t.Fatalf("expected EnvVar to fail, got %v", err)
+			}
+		}()
+		Container("frontend", EnvVar("URL", "postgres://$(PORT)"))(pod)
+	}()
+	if exp := []kube.EnvVar{{Name: "HOST", Value: "db"}}; !reflect.DeepEqual(pod.Containers[0].Env, exp) {
+		t.Errorf("expected env %v, got %v", exp, pod.Containers[0].Env)
+	}
+}
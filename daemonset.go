@@ -0,0 +1,56 @@
+package kg
+
+import (
+	"fmt"
+
+	kubeext "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+type DaemonSetOp func(ds *kubeext.DaemonSet)
+
+// newDaemonSet returns an empty DaemonSet whose pods are labeled and selected by app=name.
+func newDaemonSet(name string) *kubeext.DaemonSet {
+	ds := &kubeext.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	ds.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}}
+	ds.Spec.Template.ObjectMeta.Labels = map[string]string{"app": name}
+	return ds
+}
+
+func DaemonSetPod(podOps ...PodSpecOp) DaemonSetOp {
+	return func(ds *kubeext.DaemonSet) {
+		for _, op := range podOps {
+			op(&ds.Spec.Template.Spec)
+		}
+	}
+}
+
+// DaemonSetMaxUnavailable sets the RollingUpdate strategy with the given maximum number of
+// unavailable pods during an update, either a count such as "1" or a percentage such as "10%".
+func DaemonSetMaxUnavailable(maxUnavailable string) DaemonSetOp {
+	return func(ds *kubeext.DaemonSet) {
+		value := intstr.Parse(maxUnavailable)
+		if _, err := intstr.GetScaledValueFromIntOrPercent(&value, 100, false); err != nil {
+			Fail(fmt.Sprintf("DaemonSetMaxUnavailable(%q)", maxUnavailable), err)
+		}
+		ds.Spec.UpdateStrategy.Type = kubeext.RollingUpdateDaemonSetStrategyType
+		if ds.Spec.UpdateStrategy.RollingUpdate == nil {
+			ds.Spec.UpdateStrategy.RollingUpdate = &kubeext.RollingUpdateDaemonSet{}
+		}
+		ds.Spec.UpdateStrategy.RollingUpdate.MaxUnavailable = IntstrPtr(value)
+	}
+}
+
+// DaemonSetOnDelete sets the OnDelete strategy, which only replaces pods when they are deleted.
+func DaemonSetOnDelete() DaemonSetOp {
+	return func(ds *kubeext.DaemonSet) {
+		ds.Spec.UpdateStrategy = kubeext.DaemonSetUpdateStrategy{Type: kubeext.OnDeleteDaemonSetStrategyType}
+	}
+}
+
+// DaemonSetNodeSelector restricts the DaemonSet to nodes with the given labels, in addition to
+// any labels it already selects.
+func DaemonSetNodeSelector(nodeSelector map[string]string) DaemonSetOp {
+	return DaemonSetPod(NodeSelector(nodeSelector))
+}
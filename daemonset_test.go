@@ -0,0 +1,51 @@
+package kg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+)
+
+func TestDaemonSetOps(t *testing.T) {
+	ds := newDaemonSet("agent")
+	daemonSets := DaemonSets{Items: []*apps.DaemonSet{ds}}
+	daemonSets.Apply(
+		DaemonSetPod(Container("agent", Image("datadog/agent:7"))),
+		DaemonSetNodeSelector(map[string]string{"kubernetes.io/os": "linux"}),
+		DaemonSetNodeSelector(map[string]string{"pool": "default"}),
+		DaemonSetMaxUnavailable("10%"),
+	)
+
+	if labels := ds.Spec.Template.Labels; labels["app"] != "agent" || ds.Spec.Selector.MatchLabels["app"] != "agent" {
+		t.Errorf("expected the pods to be labeled and selected by app=agent, got %v", labels)
+	}
+	if containers := ds.Spec.Template.Spec.Containers; len(containers) != 1 || containers[0].Image != "datadog/agent:7" {
+		t.Errorf("expected container agent with image datadog/agent:7, got %+v", containers)
+	}
+	if exp := map[string]string{"kubernetes.io/os": "linux", "pool": "default"}; !reflect.DeepEqual(ds.Spec.Template.Spec.NodeSelector, exp) {
+		t.Errorf("expected node selector %v, got %v", exp, ds.Spec.Template.Spec.NodeSelector)
+	}
+	strategy := ds.Spec.UpdateStrategy
+	if strategy.Type != apps.RollingUpdateDaemonSetStrategyType || strategy.RollingUpdate.MaxUnavailable.String() != "10%" {
+		t.Errorf("expected a RollingUpdate strategy with maxUnavailable 10%%, got %+v", strategy)
+	}
+
+	daemonSets.Apply(DaemonSetOnDelete())
+	if strategy := ds.Spec.UpdateStrategy; strategy.Type != apps.OnDeleteDaemonSetStrategyType || strategy.RollingUpdate != nil {
+		t.Errorf("expected an OnDelete strategy, got %+v", strategy)
+	}
+
+	func() {
+		defer func() {
+			if err, _ := recover().(*OpError); err == nil || !strings.Contains(err.Error(), `DaemonSetMaxUnavailable("ten")`) {
+				t.Errorf("expected DaemonSetMaxUnavailable to fail, got %v", err)
+			}
+		}()
+		daemonSets.Apply(DaemonSetMaxUnavailable("ten"))
+	}()
+	if ds.Spec.UpdateStrategy.Type != apps.OnDeleteDaemonSetStrategyType {
+		t.Errorf("expected the failed op not to change the strategy, got %+v", ds.Spec.UpdateStrategy)
+	}
+}
@@ -1,9 +1,20 @@
 package kg
 
-import kubeext "k8s.io/api/apps/v1"
+import (
+	kubeext "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
 
 type DeploymentOp func(depl *kubeext.Deployment)
 
+// newDeployment returns an empty Deployment whose pods are labeled and selected by app=name.
+func newDeployment(name string) *kubeext.Deployment {
+	depl := &kubeext.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	depl.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}}
+	depl.Spec.Template.ObjectMeta.Labels = map[string]string{"app": name}
+	return depl
+}
+
 func Replicas(count int32) DeploymentOp {
 	return func(depl *kubeext.Deployment) {
 		depl.Spec.Replicas = IntPtr(count)
@@ -17,3 +28,10 @@ func Pod(podOps ...PodSpecOp) DeploymentOp {
 		}
 	}
 }
+
+// RemoveReplicas removes the replica count, leaving it to be managed by an autoscaler.
+func RemoveReplicas() DeploymentOp {
+	return func(depl *kubeext.Deployment) {
+		depl.Spec.Replicas = nil
+	}
+}
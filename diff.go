@@ -0,0 +1,197 @@
+package kg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Diff describes the changes Write would make to the files of a cluster.
+type Diff struct {
+	// Files is a map from the name of each file that would be created, changed or removed to a
+	// unified diff of the change. Files that would be created or removed are diffed against /dev/null.
+	Files map[string]string
+
+	// Created lists the files that would be created, sorted by name.
+	Created []string
+
+	// Deleted lists the files that would be removed because all of their objects were deleted,
+	// sorted by name.
+	Deleted []string
+}
+
+// String returns the diffs of all files, concatenated in order of file name.
+func (d *Diff) String() string {
+	files := make([]string, 0, len(d.Files))
+	for file := range d.Files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	var buf strings.Builder
+	for _, file := range files {
+		buf.WriteString(d.Files[file])
+	}
+	return buf.String()
+}
+
+// diffContextLines is the number of unchanged lines shown around each change in a unified diff.
+const diffContextLines = 3
+
+// unifiedDiff returns a unified diff of the change from a to b, or "" if they are equal.
+func unifiedDiff(fromName, toName string, a, b string) string {
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	// aLines[i] and bLines[i] are the number of lines of a and b before ops[i]
+	aLines := make([]int, len(ops)+1)
+	bLines := make([]int, len(ops)+1)
+	for i, op := range ops {
+		aLines[i+1], bLines[i+1] = aLines[i], bLines[i]
+		if op.kind != '+' {
+			aLines[i+1]++
+		}
+		if op.kind != '-' {
+			bLines[i+1]++
+		}
+	}
+
+	var buf strings.Builder
+	for start := 0; start < len(ops); {
+		change := start
+		for change < len(ops) && ops[change].kind == ' ' {
+			change++
+		}
+		if change == len(ops) {
+			break
+		}
+
+		// A hunk extends until there are more than 2*diffContextLines unchanged lines between
+		// changes.
+		end := change
+		for {
+			for end < len(ops) && ops[end].kind != ' ' {
+				end++
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next < len(ops) && next-end <= 2*diffContextLines {
+				end = next
+				continue
+			}
+			end = minInt(end+diffContextLines, len(ops))
+			break
+		}
+		begin := maxInt(change-diffContextLines, start)
+
+		if buf.Len() == 0 {
+			fmt.Fprintf(&buf, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n",
+			hunkRange(aLines[begin], aLines[end]-aLines[begin]),
+			hunkRange(bLines[begin], bLines[end]-bLines[begin]))
+		for _, op := range ops[begin:end] {
+			buf.WriteByte(op.kind)
+			buf.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		start = end
+	}
+	return buf.String()
+}
+
+// hunkRange formats the range of count lines after line before in a hunk header.
+func hunkRange(before, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", before)
+	case 1:
+		return fmt.Sprintf("%d", before+1)
+	default:
+		return fmt.Sprintf("%d,%d", before+1, count)
+	}
+}
+
+// splitLines splits s after each newline.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+type diffOp struct {
+	// kind is ' ' for an unchanged line, '-' for a deleted line and '+' for an inserted line
+	kind byte
+	line string
+}
+
+// diffLines returns an edit script that turns a into b, computed from their longest common
+// subsequence of lines.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	am, bm := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	// lcs[i][j] is the length of the longest common subsequence of am[i:] and bm[j:]
+	lcs := make([][]int, len(am)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bm)+1)
+	}
+	for i := len(am) - 1; i >= 0; i-- {
+		for j := len(bm) - 1; j >= 0; j-- {
+			if am[i] == bm[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = maxInt(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	for i, j := 0, 0; i < len(am) || j < len(bm); {
+		switch {
+		case i < len(am) && j < len(bm) && am[i] == bm[j]:
+			ops = append(ops, diffOp{' ', am[i]})
+			i++
+			j++
+		case i < len(am) && (j == len(bm) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', am[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', bm[j]})
+			j++
+		}
+	}
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,62 @@
+package kg
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		a, b string
+		exp  string
+	}{{
+		a:   "a\nb\n",
+		b:   "a\nb\n",
+		exp: "",
+	}, {
+		a: "a\nb\nc\n",
+		b: "a\nB\nc\n",
+		exp: `--- from
++++ to
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+`,
+	}, {
+		a: "",
+		b: "a\n",
+		exp: `--- from
++++ to
+@@ -0,0 +1 @@
++a
+`,
+	}, {
+		a: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+		b: "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\neleven\n12",
+		exp: `--- from
++++ to
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -8,5 +8,5 @@
+ 8
+ 9
+ 10
+-11
+-12
++eleven
++12
+\ No newline at end of file
+`,
+	}}
+
+	for _, test := range tests {
+		if diff := unifiedDiff("from", "to", test.a, test.b); diff != test.exp {
+			t.Errorf("diff of %q and %q: expected\n%s\nbut got\n%s", test.a, test.b, test.exp, diff)
+		}
+	}
+}
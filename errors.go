@@ -0,0 +1,101 @@
+package kg
+
+import (
+	"fmt"
+	"strings"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// OpError is the failure of an op applied to an object.
+type OpError struct {
+	// File is the file containing the object, if the object belongs to a Cluster
+	File string
+
+	// Kind and Name identify the object, if the op was applied with Apply
+	Kind string
+	Name string
+
+	// Op describes the op that failed, e.g. `DiskSize("10Gx")`
+	Op  string
+	Err error
+}
+
+func (e *OpError) Error() string {
+	var prefix string
+	if e.File != "" {
+		prefix = e.File + ": "
+	}
+	if e.Kind != "" || e.Name != "" {
+		prefix += strings.TrimSpace(e.Kind+" "+e.Name) + ": "
+	}
+	return fmt.Sprintf("%s%s: %v", prefix, e.Op, e.Err)
+}
+
+// ConflictError is recorded when an object cannot be created because the file it would be
+// written to already exists.
+type ConflictError struct {
+	File string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("new file %s would conflict with existing file", e.File)
+}
+
+// MissingImagesError is recorded by PinImages when images are missing from the lockfile.
+type MissingImagesError struct {
+	// Images are the missing image references, sorted
+	Images []string
+}
+
+func (e *MissingImagesError) Error() string {
+	return fmt.Sprintf("images missing from lockfile: %s", strings.Join(e.Images, ", "))
+}
+
+// Fail aborts the op that calls it. op describes the failing op, e.g. `DiskSize("10Gx")`.
+//
+// When the op is applied with Apply to objects selected from a Cluster, the failure is recorded on
+// the Cluster, and ModifyCluster returns every recorded failure as one error instead of writing any
+// files. A failure in a constructor like PodSpec or Service, or in an op applied to objects that
+// were not selected from a Cluster, panics with an *OpError; ModifyCluster and DryRunCluster recover
+// it and record it as well.
+func Fail(op string, err error) {
+	panic(&OpError{Op: op, Err: err})
+}
+
+// runOp calls op, which modifies obj, an object of c. A failure reported by Fail is recorded on
+// c, or panicked again as an *OpError if c is nil.
+func (c *Cluster) runOp(obj Object, op func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(*OpError)
+			if !ok {
+				panic(r)
+			}
+			err.Kind = obj.GetObjectKind().GroupVersionKind().Kind
+			err.Name = obj.GetName()
+			if c == nil {
+				panic(err)
+			}
+			err.File = c.index[obj]
+			c.errs = append(c.errs, err)
+		}
+	}()
+	op()
+}
+
+// recordFailure records a failure reported by Fail outside of an op, e.g. by an invalid Filter. r
+// is the value returned by recover; values that are not failures are panicked again.
+func (c *Cluster) recordFailure(r interface{}) {
+	err, ok := r.(*OpError)
+	if !ok {
+		panic(r)
+	}
+	c.errs = append(c.errs, err)
+}
+
+// Err returns every error recorded while modifying the cluster, including failed ops, aggregated
+// into one error. It returns nil if there were none.
+func (c *Cluster) Err() error {
+	return utilerrors.NewAggregate(c.errs)
+}
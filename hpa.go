@@ -0,0 +1,198 @@
+package kg
+
+import (
+	"fmt"
+
+	autoscaling "k8s.io/api/autoscaling/v2"
+	kube "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+type HorizontalPodAutoscalerOp func(hpa *autoscaling.HorizontalPodAutoscaler)
+
+func newHorizontalPodAutoscaler(name string) *autoscaling.HorizontalPodAutoscaler {
+	return &autoscaling.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: name}}
+}
+
+// Autoscale selects the HorizontalPodAutoscaler with the same name and namespace as target, a
+// Deployment or StatefulSet, creating it if it does not exist, and sets it to scale target between minReplicas
+// and maxReplicas. Remove the target's own replica count with RemoveReplicas or
+// RemoveStatefulSetReplicas so that applying it doesn't undo the autoscaler's changes.
+func (c *Cluster) Autoscale(target Object, minReplicas, maxReplicas int32) HorizontalPodAutoscalers {
+	hpas := c.selectOrCreateIn(target.GetNamespace(), target.GetName(), func(name string) runtime.Object { return newHorizontalPodAutoscaler(name) }).HorizontalPodAutoscalers()
+	hpas.Apply(ScaleTarget(target), ReplicaRange(minReplicas, maxReplicas))
+	return hpas
+}
+
+// ScaleTarget sets the object scaled by the autoscaler, and puts the autoscaler in the target's
+// namespace if it has none.
+func ScaleTarget(target Object) HorizontalPodAutoscalerOp {
+	return func(hpa *autoscaling.HorizontalPodAutoscaler) {
+		gvk := target.GetObjectKind().GroupVersionKind()
+		if gvk.Empty() {
+			gvks, _, err := scheme.Scheme.ObjectKinds(target.(runtime.Object))
+			if err != nil {
+				Fail(fmt.Sprintf("ScaleTarget(%s)", target.GetName()), err)
+			}
+			gvk = gvks[0]
+		}
+		apiVersion, kind := gvk.ToAPIVersionAndKind()
+		hpa.Spec.ScaleTargetRef = autoscaling.CrossVersionObjectReference{
+			APIVersion: apiVersion,
+			Kind:       kind,
+			Name:       target.GetName(),
+		}
+		if hpa.Namespace == "" {
+			hpa.Namespace = target.GetNamespace()
+		}
+	}
+}
+
+func ReplicaRange(minReplicas, maxReplicas int32) HorizontalPodAutoscalerOp {
+	return func(hpa *autoscaling.HorizontalPodAutoscaler) {
+		if minReplicas < 1 || minReplicas > maxReplicas {
+			Fail(fmt.Sprintf("ReplicaRange(%d, %d)", minReplicas, maxReplicas), fmt.Errorf("expected 1 <= min <= max"))
+		}
+		hpa.Spec.MinReplicas = Int32Ptr(minReplicas)
+		hpa.Spec.MaxReplicas = maxReplicas
+	}
+}
+
+// CPUUtilization sets the target average CPU utilization of the pods, as a percentage of their
+// CPU requests.
+func CPUUtilization(percent int32) HorizontalPodAutoscalerOp {
+	return resourceUtilization(kube.ResourceCPU, percent)
+}
+
+// MemoryUtilization sets the target average memory utilization of the pods, as a percentage of
+// their memory requests.
+func MemoryUtilization(percent int32) HorizontalPodAutoscalerOp {
+	return resourceUtilization(kube.ResourceMemory, percent)
+}
+
+func resourceUtilization(name kube.ResourceName, percent int32) HorizontalPodAutoscalerOp {
+	return func(hpa *autoscaling.HorizontalPodAutoscaler) {
+		setMetric(hpa, autoscaling.MetricSpec{
+			Type: autoscaling.ResourceMetricSourceType,
+			Resource: &autoscaling.ResourceMetricSource{
+				Name: name,
+				Target: autoscaling.MetricTarget{
+					Type:               autoscaling.UtilizationMetricType,
+					AverageUtilization: Int32Ptr(percent),
+				},
+			},
+		})
+	}
+}
+
+// PodsMetric sets the target average value across the pods of a custom metric, such as
+// "http_requests_per_second".
+func PodsMetric(name, averageValue string) HorizontalPodAutoscalerOp {
+	return func(hpa *autoscaling.HorizontalPodAutoscaler) {
+		q, err := resource.ParseQuantity(averageValue)
+		if err != nil {
+			Fail(fmt.Sprintf("PodsMetric(%q, %q)", name, averageValue), err)
+		}
+		setMetric(hpa, autoscaling.MetricSpec{
+			Type: autoscaling.PodsMetricSourceType,
+			Pods: &autoscaling.PodsMetricSource{
+				Metric: autoscaling.MetricIdentifier{Name: name},
+				Target: autoscaling.MetricTarget{
+					Type:         autoscaling.AverageValueMetricType,
+					AverageValue: &q,
+				},
+			},
+		})
+	}
+}
+
+// RemoveMetric removes the resource or custom metric with the given name, if it exists.
+func RemoveMetric(name string) HorizontalPodAutoscalerOp {
+	return func(hpa *autoscaling.HorizontalPodAutoscaler) {
+		for i := range hpa.Spec.Metrics {
+			if metricName(hpa.Spec.Metrics[i]) == name {
+				hpa.Spec.Metrics = append(hpa.Spec.Metrics[:i], hpa.Spec.Metrics[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// setMetric replaces the metric of hpa with the same type and name as m, or adds m.
+func setMetric(hpa *autoscaling.HorizontalPodAutoscaler, m autoscaling.MetricSpec) {
+	for i := range hpa.Spec.Metrics {
+		if hpa.Spec.Metrics[i].Type == m.Type && metricName(hpa.Spec.Metrics[i]) == metricName(m) {
+			hpa.Spec.Metrics[i] = m
+			return
+		}
+	}
+	hpa.Spec.Metrics = append(hpa.Spec.Metrics, m)
+}
+
+func metricName(m autoscaling.MetricSpec) string {
+	switch {
+	case m.Resource != nil:
+		return string(m.Resource.Name)
+	case m.ContainerResource != nil:
+		return string(m.ContainerResource.Name)
+	case m.Pods != nil:
+		return m.Pods.Metric.Name
+	case m.Object != nil:
+		return m.Object.Metric.Name
+	case m.External != nil:
+		return m.External.Metric.Name
+	}
+	return ""
+}
+
+// ScaleUpPolicy adds a policy limiting how fast the autoscaler adds pods, e.g.
+// ScaleUpPolicy(autoscaling.PercentScalingPolicy, 100, 60) to at most double them every minute.
+// A policy of the same type and period is replaced.
+func ScaleUpPolicy(policyType autoscaling.HPAScalingPolicyType, value, periodSeconds int32) HorizontalPodAutoscalerOp {
+	return func(hpa *autoscaling.HorizontalPodAutoscaler) {
+		setScalingPolicy(&scalingRules(hpa).ScaleUp, autoscaling.HPAScalingPolicy{Type: policyType, Value: value, PeriodSeconds: periodSeconds})
+	}
+}
+
+// ScaleDownPolicy adds a policy limiting how fast the autoscaler removes pods. A policy of the
+// same type and period is replaced.
+func ScaleDownPolicy(policyType autoscaling.HPAScalingPolicyType, value, periodSeconds int32) HorizontalPodAutoscalerOp {
+	return func(hpa *autoscaling.HorizontalPodAutoscaler) {
+		setScalingPolicy(&scalingRules(hpa).ScaleDown, autoscaling.HPAScalingPolicy{Type: policyType, Value: value, PeriodSeconds: periodSeconds})
+	}
+}
+
+// ScaleDownStabilization sets how long the autoscaler considers past recommendations before
+// removing pods, which prevents flapping.
+func ScaleDownStabilization(seconds int32) HorizontalPodAutoscalerOp {
+	return func(hpa *autoscaling.HorizontalPodAutoscaler) {
+		rules := &scalingRules(hpa).ScaleDown
+		if *rules == nil {
+			*rules = &autoscaling.HPAScalingRules{}
+		}
+		(*rules).StabilizationWindowSeconds = Int32Ptr(seconds)
+	}
+}
+
+func scalingRules(hpa *autoscaling.HorizontalPodAutoscaler) *autoscaling.HorizontalPodAutoscalerBehavior {
+	if hpa.Spec.Behavior == nil {
+		hpa.Spec.Behavior = &autoscaling.HorizontalPodAutoscalerBehavior{}
+	}
+	return hpa.Spec.Behavior
+}
+
+func setScalingPolicy(rules **autoscaling.HPAScalingRules, policy autoscaling.HPAScalingPolicy) {
+	if *rules == nil {
+		*rules = &autoscaling.HPAScalingRules{}
+	}
+	for i, p := range (*rules).Policies {
+		if p.Type == policy.Type && p.PeriodSeconds == policy.PeriodSeconds {
+			(*rules).Policies[i] = policy
+			return
+		}
+	}
+	(*rules).Policies = append((*rules).Policies, policy)
+}
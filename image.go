@@ -0,0 +1,224 @@
+package kg
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	kube "k8s.io/api/core/v1"
+)
+
+// imageRef is a parsed container image reference of the form
+// [registry/]repository[:tag][@digest].
+type imageRef struct {
+	// Registry is the registry host, with an optional port, or "" if the reference has none and
+	// refers to Docker Hub
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+var (
+	registryPattern   = regexp.MustCompile(`^[a-zA-Z0-9](?:[a-zA-Z0-9.-]*[a-zA-Z0-9])?(?::[0-9]+)?$`)
+	repositoryPattern = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	tagPattern        = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestPattern     = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]{32,}$`)
+)
+
+// dockerHub is the registry of image references that have none.
+const dockerHub = "docker.io"
+
+func parseImage(image string) (imageRef, error) {
+	var ref imageRef
+	rest := image
+	if i := strings.Index(rest, "@"); i >= 0 {
+		rest, ref.Digest = rest[:i], rest[i+1:]
+		if !digestPattern.MatchString(ref.Digest) {
+			return imageRef{}, fmt.Errorf("invalid digest %q in image %q", ref.Digest, image)
+		}
+	}
+	if i := strings.LastIndex(rest, ":"); i > strings.LastIndex(rest, "/") {
+		rest, ref.Tag = rest[:i], rest[i+1:]
+		if !tagPattern.MatchString(ref.Tag) {
+			return imageRef{}, fmt.Errorf("invalid tag %q in image %q", ref.Tag, image)
+		}
+	}
+	// The first component is a registry if it looks like a host name
+	if i := strings.Index(rest, "/"); i >= 0 {
+		if first := rest[:i]; strings.ContainsAny(first, ".:") || first == "localhost" {
+			if !registryPattern.MatchString(first) {
+				return imageRef{}, fmt.Errorf("invalid registry %q in image %q", first, image)
+			}
+			ref.Registry, rest = first, rest[i+1:]
+		}
+	}
+	if !repositoryPattern.MatchString(rest) {
+		return imageRef{}, fmt.Errorf("invalid repository %q in image %q", rest, image)
+	}
+	ref.Repository = rest
+	return ref, nil
+}
+
+func (r imageRef) String() string {
+	s := r.Repository
+	if r.Registry != "" {
+		s = r.Registry + "/" + s
+	}
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// name returns the registry and repository of r, with Docker Hub's implicit registry and library
+// namespace filled in, e.g. "docker.io/library/nginx" for "nginx".
+func (r imageRef) name() string {
+	registry, repository := r.Registry, r.Repository
+	if registry == "" || registry == "index.docker.io" {
+		registry = dockerHub
+	}
+	if registry == dockerHub && !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+	return registry + "/" + repository
+}
+
+// Image sets the container's image, e.g. "nginx:1.21" or "gcr.io/project/app@sha256:...".
+func Image(image string) ContainerOp {
+	return func(pod *kube.PodSpec, container *kube.Container) {
+		if _, err := parseImage(image); err != nil {
+			Fail(fmt.Sprintf("Image(%q)", image), err)
+		}
+		container.Image = image
+	}
+}
+
+// ImageTag sets the tag of the container's image, removing its digest, which would take
+// precedence over the tag.
+func ImageTag(tag string) ContainerOp {
+	return func(pod *kube.PodSpec, container *kube.Container) {
+		op := fmt.Sprintf("ImageTag(%q)", tag)
+		ref, err := parseImage(container.Image)
+		if err != nil {
+			Fail(op, err)
+		}
+		if !tagPattern.MatchString(tag) {
+			Fail(op, fmt.Errorf("invalid tag %q", tag))
+		}
+		ref.Tag, ref.Digest = tag, ""
+		container.Image = ref.String()
+	}
+}
+
+// ImageDigest pins the container's image to a digest, e.g. "sha256:...". The tag is kept for
+// readability.
+func ImageDigest(digest string) ContainerOp {
+	return func(pod *kube.PodSpec, container *kube.Container) {
+		op := fmt.Sprintf("ImageDigest(%q)", digest)
+		ref, err := parseImage(container.Image)
+		if err != nil {
+			Fail(op, err)
+		}
+		if !digestPattern.MatchString(digest) {
+			Fail(op, fmt.Errorf("invalid digest %q", digest))
+		}
+		ref.Digest = digest
+		container.Image = ref.String()
+	}
+}
+
+// ImageChange describes a container image changed by RewriteRegistry.
+type ImageChange struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Container string
+	From, To  string
+}
+
+// RewriteRegistry rewrites the images of the containers and init containers of every workload in
+// the cluster whose registry and repository start with from, replacing that prefix with to. For
+// example, RewriteRegistry("docker.io/*", "mirror.internal/*") rewrites "nginx:1.21" to
+// "mirror.internal/library/nginx:1.21". A trailing "/*" on either prefix is optional. Tags and
+// digests are kept. Containers without an image, or whose image is not under from, are skipped
+// without being validated. If any image of a workload cannot be rewritten, none of its images
+// are. It returns every image it changed.
+func (c *Cluster) RewriteRegistry(from, to string) []ImageChange {
+	op := fmt.Sprintf("RewriteRegistry(%q, %q)", from, to)
+	from, to = strings.TrimSuffix(from, "/*"), strings.TrimSuffix(to, "/*")
+	under := func(name string) bool {
+		return name == from || strings.HasPrefix(name, from+"/")
+	}
+
+	var changes []ImageChange
+	for _, obj := range c.objects() {
+		w, ok := workload(obj)
+		if !ok {
+			continue
+		}
+		c.runOp(w.Object, func() {
+			var rewrites []ImageChange
+			var images []*string
+			spec := &w.Template.Spec
+			for _, containers := range [][]kube.Container{spec.InitContainers, spec.Containers} {
+				for i := range containers {
+					container := &containers[i]
+					if container.Image == "" || !under(imageName(container.Image)) {
+						continue
+					}
+					ref, err := parseImage(container.Image)
+					if err != nil {
+						Fail(op, fmt.Errorf("container %s: %v", container.Name, err))
+					}
+					rewritten, err := parseImage(to + strings.TrimPrefix(ref.name(), from))
+					if err != nil {
+						Fail(op, fmt.Errorf("container %s: %v", container.Name, err))
+					}
+					rewritten.Tag, rewritten.Digest = ref.Tag, ref.Digest
+
+					rewrites = append(rewrites, ImageChange{
+						Kind:      w.GetObjectKind().GroupVersionKind().Kind,
+						Namespace: w.GetNamespace(),
+						Name:      w.GetName(),
+						Container: container.Name,
+						From:      container.Image,
+						To:        rewritten.String(),
+					})
+					images = append(images, &container.Image)
+				}
+			}
+
+			// Rewrite the images only once all of them are known to be valid
+			for i, image := range images {
+				*image = rewrites[i].To
+			}
+			if len(rewrites) > 0 {
+				c.touch(obj)
+			}
+			changes = append(changes, rewrites...)
+		})
+	}
+	return changes
+}
+
+// imageName returns the name of image like imageRef.name, without validating it.
+func imageName(image string) string {
+	var ref imageRef
+	ref.Repository = image
+	if i := strings.Index(ref.Repository, "@"); i >= 0 {
+		ref.Repository = ref.Repository[:i]
+	}
+	if i := strings.LastIndex(ref.Repository, ":"); i > strings.LastIndex(ref.Repository, "/") {
+		ref.Repository = ref.Repository[:i]
+	}
+	if i := strings.Index(ref.Repository, "/"); i >= 0 {
+		if first := ref.Repository[:i]; strings.ContainsAny(first, ".:") || first == "localhost" {
+			ref.Registry, ref.Repository = first, ref.Repository[i+1:]
+		}
+	}
+	return ref.name()
+}
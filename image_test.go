@@ -0,0 +1,40 @@
+package kg
+
+import "testing"
+
+func TestParseImage(t *testing.T) {
+	digest := "sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		image string
+		want  imageRef
+		name  string
+	}{
+		{"nginx", imageRef{Repository: "nginx"}, "docker.io/library/nginx"},
+		{"nginx:1.21", imageRef{Repository: "nginx", Tag: "1.21"}, "docker.io/library/nginx"},
+		{"sourcegraph/server:3.0", imageRef{Repository: "sourcegraph/server", Tag: "3.0"}, "docker.io/sourcegraph/server"},
+		{"localhost:5000/app", imageRef{Registry: "localhost:5000", Repository: "app"}, "localhost:5000/app"},
+		{"gcr.io/project/app:v1@" + digest, imageRef{Registry: "gcr.io", Repository: "project/app", Tag: "v1", Digest: digest}, "gcr.io/project/app"},
+	}
+	for _, test := range tests {
+		ref, err := parseImage(test.image)
+		if err != nil {
+			t.Errorf("%s: %v", test.image, err)
+			continue
+		}
+		if ref != test.want {
+			t.Errorf("%s: expected %+v, got %+v", test.image, test.want, ref)
+		}
+		if ref.String() != test.image {
+			t.Errorf("%s: expected String to round-trip, got %s", test.image, ref)
+		}
+		if ref.name() != test.name {
+			t.Errorf("%s: expected name %s, got %s", test.image, test.name, ref.name())
+		}
+	}
+
+	for _, image := range []string{"", "Nginx", "nginx:", "nginx@sha256:short", "nginx:bad/tag"} {
+		if _, err := parseImage(image); err == nil {
+			t.Errorf("%s: expected an error", image)
+		}
+	}
+}
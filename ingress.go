@@ -0,0 +1,148 @@
+package kg
+
+import (
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Ingress(name string, ops ...IngressOp) *networking.Ingress {
+	ing := &networking.Ingress{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	for _, op := range ops {
+		op(ing)
+	}
+	return ing
+}
+
+type IngressOp func(*networking.Ingress)
+
+// IngressPath routes requests for host whose path has the prefix path to the named port of the
+// named service. It adds the rule for host and the path if they do not exist, or updates the
+// backend of the existing path. An empty host matches requests for any host.
+func IngressPath(host, path, service, port string) IngressOp {
+	return func(ing *networking.Ingress) {
+		http := ingressRule(ing, host).HTTP
+		p := ingressPath(http, path)
+		if p.PathType == nil {
+			pathType := networking.PathTypePrefix
+			p.PathType = &pathType
+		}
+		p.Backend = ingressBackend(service, port)
+	}
+}
+
+// ingressRule returns the rule of ing for host, adding it if it does not exist. The rule's HTTP
+// field is always set.
+func ingressRule(ing *networking.Ingress, host string) *networking.IngressRule {
+	var rule *networking.IngressRule
+	for i := range ing.Spec.Rules {
+		if ing.Spec.Rules[i].Host == host {
+			rule = &ing.Spec.Rules[i]
+			break
+		}
+	}
+	if rule == nil {
+		ing.Spec.Rules = append(ing.Spec.Rules, networking.IngressRule{Host: host})
+		rule = &ing.Spec.Rules[len(ing.Spec.Rules)-1]
+	}
+	if rule.HTTP == nil {
+		rule.HTTP = &networking.HTTPIngressRuleValue{}
+	}
+	return rule
+}
+
+// ingressPath returns the path of http with the given path, adding it if it does not exist.
+func ingressPath(http *networking.HTTPIngressRuleValue, path string) *networking.HTTPIngressPath {
+	for i := range http.Paths {
+		if http.Paths[i].Path == path {
+			return &http.Paths[i]
+		}
+	}
+	http.Paths = append(http.Paths, networking.HTTPIngressPath{Path: path})
+	return &http.Paths[len(http.Paths)-1]
+}
+
+func ingressBackend(service, port string) networking.IngressBackend {
+	return networking.IngressBackend{
+		Service: &networking.IngressServiceBackend{
+			Name: service,
+			Port: networking.ServiceBackendPort{Name: port},
+		},
+	}
+}
+
+// RemoveIngressPath removes the path of the rule for host, if it exists, and removes the rule if
+// it has no paths left.
+func RemoveIngressPath(host, path string) IngressOp {
+	return func(ing *networking.Ingress) {
+		for i := range ing.Spec.Rules {
+			rule := &ing.Spec.Rules[i]
+			if rule.Host != host || rule.HTTP == nil {
+				continue
+			}
+			for j := range rule.HTTP.Paths {
+				if rule.HTTP.Paths[j].Path == path {
+					rule.HTTP.Paths = append(rule.HTTP.Paths[:j], rule.HTTP.Paths[j+1:]...)
+					break
+				}
+			}
+			if len(rule.HTTP.Paths) == 0 {
+				ing.Spec.Rules = append(ing.Spec.Rules[:i], ing.Spec.Rules[i+1:]...)
+			}
+			return
+		}
+	}
+}
+
+// IngressDefaultBackend routes requests that match no rule to the named port of the named
+// service.
+func IngressDefaultBackend(service, port string) IngressOp {
+	return func(ing *networking.Ingress) {
+		backend := ingressBackend(service, port)
+		ing.Spec.DefaultBackend = &backend
+	}
+}
+
+// IngressTLS terminates TLS for hosts with the certificate in the named secret. It adds the TLS
+// block for the secret if it does not exist, or adds hosts to the existing block.
+func IngressTLS(secretName string, hosts ...string) IngressOp {
+	return func(ing *networking.Ingress) {
+		for i := range ing.Spec.TLS {
+			if ing.Spec.TLS[i].SecretName == secretName {
+				ing.Spec.TLS[i].Hosts = mergeStrings(ing.Spec.TLS[i].Hosts, hosts)
+				return
+			}
+		}
+		ing.Spec.TLS = append(ing.Spec.TLS, networking.IngressTLS{SecretName: secretName, Hosts: mergeStrings(nil, hosts)})
+	}
+}
+
+// RemoveIngressTLS removes the TLS block for the named secret, if it exists.
+func RemoveIngressTLS(secretName string) IngressOp {
+	return func(ing *networking.Ingress) {
+		for i := range ing.Spec.TLS {
+			if ing.Spec.TLS[i].SecretName == secretName {
+				ing.Spec.TLS = append(ing.Spec.TLS[:i], ing.Spec.TLS[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// IngressClass sets the name of the IngressClass that implements the Ingress.
+func IngressClass(name string) IngressOp {
+	return func(ing *networking.Ingress) {
+		ing.Spec.IngressClassName = &name
+	}
+}
+
+// IngressAnnotations merges annotations into the Ingress's annotations.
+func IngressAnnotations(annotations map[string]string) IngressOp {
+	return func(ing *networking.Ingress) {
+		if ing.Annotations == nil {
+			ing.Annotations = make(map[string]string)
+		}
+		for k, v := range annotations {
+			ing.Annotations[k] = v
+		}
+	}
+}
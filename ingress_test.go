@@ -0,0 +1,42 @@
+package kg
+
+import (
+	"reflect"
+	"testing"
+
+	networking "k8s.io/api/networking/v1"
+)
+
+func TestIngressOpsIdempotent(t *testing.T) {
+	ops := []IngressOp{
+		IngressPath("example.com", "/", "frontend", "http"),
+		IngressPath("example.com", "/api", "backend", "http"),
+		IngressPath("example.com", "/", "frontend", "https"),
+		IngressTLS("example-tls", "example.com"),
+		IngressTLS("example-tls", "example.com", "www.example.com"),
+		IngressClass("nginx"),
+	}
+
+	once := Ingress("frontend", ops...)
+	twice := Ingress("frontend", ops...)
+	Ingresses{Items: []*networking.Ingress{twice}}.Apply(ops...)
+	if !reflect.DeepEqual(once, twice) {
+		t.Errorf("expected applying ops twice to be a no-op, got\n%+v\nand\n%+v", once, twice)
+	}
+
+	if n := len(once.Spec.Rules); n != 1 {
+		t.Fatalf("expected 1 rule, got %d", n)
+	}
+	paths := once.Spec.Rules[0].HTTP.Paths
+	if len(paths) != 2 || paths[0].Backend.Service.Port.Name != "https" {
+		t.Errorf("expected the backend of / to be updated, got %+v", paths)
+	}
+	if n := len(once.Spec.TLS); n != 1 || len(once.Spec.TLS[0].Hosts) != 2 {
+		t.Errorf("expected 1 TLS block with 2 hosts, got %+v", once.Spec.TLS)
+	}
+
+	Ingresses{Items: []*networking.Ingress{once}}.Apply(RemoveIngressPath("example.com", "/"), RemoveIngressPath("example.com", "/api"))
+	if n := len(once.Spec.Rules); n != 0 {
+		t.Errorf("expected the empty rule to be removed, got %d rules", n)
+	}
+}
@@ -0,0 +1,198 @@
+package kg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	batch "k8s.io/api/batch/v1"
+	kube "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type JobOp func(job *batch.Job)
+
+type CronJobOp func(cronJob *batch.CronJob)
+
+// JobSpecOp modifies the spec of a Job, or of the jobs created by a CronJob.
+type JobSpecOp func(spec *batch.JobSpec)
+
+// newJob returns an empty Job whose pods are labeled app=name and are not restarted on failure.
+func newJob(name string) *batch.Job {
+	job := &batch.Job{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	job.Spec.Template.ObjectMeta.Labels = map[string]string{"app": name}
+	job.Spec.Template.Spec.RestartPolicy = kube.RestartPolicyNever
+	return job
+}
+
+// newCronJob returns an empty CronJob whose pods are labeled app=name and are not restarted on
+// failure. Its schedule must be set with Schedule.
+func newCronJob(name string) *batch.CronJob {
+	cronJob := &batch.CronJob{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	cronJob.Spec.JobTemplate.Spec.Template.ObjectMeta.Labels = map[string]string{"app": name}
+	cronJob.Spec.JobTemplate.Spec.Template.Spec.RestartPolicy = kube.RestartPolicyNever
+	return cronJob
+}
+
+func JobSpec(ops ...JobSpecOp) JobOp {
+	return func(job *batch.Job) {
+		for _, op := range ops {
+			op(&job.Spec)
+		}
+	}
+}
+
+// JobTemplate modifies the spec of the jobs created by a CronJob.
+func JobTemplate(ops ...JobSpecOp) CronJobOp {
+	return func(cronJob *batch.CronJob) {
+		for _, op := range ops {
+			op(&cronJob.Spec.JobTemplate.Spec)
+		}
+	}
+}
+
+func JobPod(podOps ...PodSpecOp) JobSpecOp {
+	return func(spec *batch.JobSpec) {
+		for _, op := range podOps {
+			op(&spec.Template.Spec)
+		}
+	}
+}
+
+// BackoffLimit sets the number of retries before a job is marked failed.
+func BackoffLimit(retries int32) JobSpecOp {
+	return func(spec *batch.JobSpec) {
+		spec.BackoffLimit = Int32Ptr(retries)
+	}
+}
+
+// ActiveDeadlineSeconds sets how long a job may run before it is terminated and marked failed.
+func ActiveDeadlineSeconds(seconds int64) JobSpecOp {
+	return func(spec *batch.JobSpec) {
+		spec.ActiveDeadlineSeconds = Int64Ptr(seconds)
+	}
+}
+
+// cronMacros are the schedule shorthands accepted in place of five cron fields.
+var cronMacros = map[string]bool{
+	"@yearly": true, "@annually": true, "@monthly": true, "@weekly": true,
+	"@daily": true, "@midnight": true, "@hourly": true,
+}
+
+// cronField describes the values allowed in one of the five fields of a cron schedule.
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // names of the values from min, e.g. JAN for 1
+	anyDay   bool     // whether "?" is allowed as an alias of "*"
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31, anyDay: true},
+	{name: "month", min: 1, max: 12, names: []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}},
+	{name: "day of week", min: 0, max: 6, names: []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}, anyDay: true},
+}
+
+// Schedule sets the cron schedule of a CronJob: five fields such as "0 3 * * *", a macro such as
+// "@daily", or "@every" followed by a duration such as "@every 1h30m".
+func Schedule(schedule string) CronJobOp {
+	return func(cronJob *batch.CronJob) {
+		if err := validateSchedule(schedule); err != nil {
+			Fail(fmt.Sprintf("Schedule(%q)", schedule), err)
+		}
+		cronJob.Spec.Schedule = schedule
+	}
+}
+
+func validateSchedule(schedule string) error {
+	if cronMacros[schedule] {
+		return nil
+	}
+	if strings.HasPrefix(schedule, "@every ") {
+		d, err := time.ParseDuration(strings.TrimPrefix(schedule, "@every "))
+		if err != nil {
+			return err
+		}
+		if d <= 0 {
+			return fmt.Errorf("expected a positive duration, got %s", d)
+		}
+		return nil
+	}
+
+	fields := strings.Fields(schedule)
+	if len(fields) != len(cronFields) {
+		return fmt.Errorf("expected 5 fields or a macro such as @daily, got %d fields", len(fields))
+	}
+	for i, field := range fields {
+		if err := cronFields[i].validate(field); err != nil {
+			return fmt.Errorf("%s: %v", cronFields[i].name, err)
+		}
+	}
+	return nil
+}
+
+// validate checks a comma-separated list of ranges, each "*", a value or "from-to", optionally
+// followed by "/step". Values may also be given by name, e.g. MON.
+func (f cronField) validate(field string) error {
+	for _, r := range strings.Split(field, ",") {
+		if i := strings.Index(r, "/"); i >= 0 {
+			if step, err := strconv.Atoi(r[i+1:]); err != nil || step <= 0 {
+				return fmt.Errorf("invalid step in %q", r)
+			}
+			r = r[:i]
+		}
+		if r == "*" || r == "?" && f.anyDay {
+			continue
+		}
+		bounds := strings.SplitN(r, "-", 2)
+		var values []int
+		for _, b := range bounds {
+			v, err := f.value(b)
+			if err != nil {
+				return err
+			}
+			values = append(values, v)
+		}
+		if len(values) == 2 && values[0] > values[1] {
+			return fmt.Errorf("invalid range %q", r)
+		}
+	}
+	return nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value %q, expected %d-%d", s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// ConcurrencyPolicy sets whether a CronJob's jobs may run concurrently: batch.AllowConcurrent,
+// batch.ForbidConcurrent or batch.ReplaceConcurrent.
+func ConcurrencyPolicy(policy batch.ConcurrencyPolicy) CronJobOp {
+	return func(cronJob *batch.CronJob) {
+		switch policy {
+		case batch.AllowConcurrent, batch.ForbidConcurrent, batch.ReplaceConcurrent:
+		default:
+			Fail(fmt.Sprintf("ConcurrencyPolicy(%q)", policy), fmt.Errorf("unknown concurrency policy"))
+		}
+		cronJob.Spec.ConcurrencyPolicy = policy
+	}
+}
+
+// HistoryLimits sets the number of successful and failed finished jobs a CronJob keeps.
+func HistoryLimits(successful, failed int32) CronJobOp {
+	return func(cronJob *batch.CronJob) {
+		cronJob.Spec.SuccessfulJobsHistoryLimit = Int32Ptr(successful)
+		cronJob.Spec.FailedJobsHistoryLimit = Int32Ptr(failed)
+	}
+}
@@ -0,0 +1,57 @@
+package kg
+
+import (
+	"reflect"
+	"testing"
+
+	batch "k8s.io/api/batch/v1"
+)
+
+func TestSchedule(t *testing.T) {
+	tests := []struct {
+		schedule string
+		valid    bool
+	}{
+		{"0 3 * * *", true},
+		{"*/15 9-17 * * MON-FRI", true},
+		{"0 0 1,15 jan,jul ?", true},
+		{"@daily", true},
+		{"@every 1h", true},
+		{"@every 1h30m", true},
+		{"@every 0s", false},
+		{"@every hour", false},
+		{"@often", false},
+		{"0 3 * *", false},
+		{"60 * * * *", false},
+		{"0 24 * * *", false},
+		{"0 0 0 * *", false},
+		{"0 0 * 13 *", false},
+		{"0 0 * * 7", false},
+		{"? * * * *", false},
+		{"*/0 * * * *", false},
+		{"5-1 * * * *", false},
+		{"x y z a b", false},
+	}
+	for _, test := range tests {
+		if err := validateSchedule(test.schedule); (err == nil) != test.valid {
+			t.Errorf("validateSchedule(%q): expected valid=%v, got %v", test.schedule, test.valid, err)
+		}
+	}
+}
+
+func TestCronJobOpsIdempotent(t *testing.T) {
+	ops := []CronJobOp{
+		Schedule("@every 6h"),
+		ConcurrencyPolicy(batch.ForbidConcurrent),
+		HistoryLimits(3, 1),
+		JobTemplate(BackoffLimit(2), ActiveDeadlineSeconds(600), JobPod(Container("backup", Image("postgres:16")))),
+	}
+
+	once := newCronJob("backup")
+	twice := newCronJob("backup")
+	CronJobs{Items: []*batch.CronJob{once}}.Apply(ops...)
+	CronJobs{Items: []*batch.CronJob{twice}}.Apply(append(ops, ops...)...)
+	if !reflect.DeepEqual(once, twice) {
+		t.Errorf("expected applying ops twice to be a no-op, got\n%+v\nand\n%+v", once, twice)
+	}
+}
@@ -0,0 +1,256 @@
+package kg
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	kube "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+type NamespaceOp func(ns *kube.Namespace)
+
+type ResourceQuotaOp func(quota *kube.ResourceQuota)
+
+type LimitRangeOp func(lr *kube.LimitRange)
+
+func newNamespace(name string) *kube.Namespace {
+	return &kube.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+}
+
+func newResourceQuota(name string) *kube.ResourceQuota {
+	return &kube.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: name}}
+}
+
+func newLimitRange(name string) *kube.LimitRange {
+	return &kube.LimitRange{ObjectMeta: metav1.ObjectMeta{Name: name}}
+}
+
+// clusterScopedKinds are the built-in kinds of objects that do not belong to a namespace.
+var clusterScopedKinds = map[schema.GroupKind]bool{
+	{Group: "", Kind: "ComponentStatus"}:                                              true,
+	{Group: "", Kind: "Namespace"}:                                                    true,
+	{Group: "", Kind: "Node"}:                                                         true,
+	{Group: "", Kind: "PersistentVolume"}:                                             true,
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingAdmissionPolicy"}:          true,
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingAdmissionPolicyBinding"}:   true,
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"}:     true,
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingAdmissionPolicy"}:        true,
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingAdmissionPolicyBinding"}: true,
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingWebhookConfiguration"}:   true,
+	{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}:                 true,
+	{Group: "apiregistration.k8s.io", Kind: "APIService"}:                             true,
+	{Group: "authentication.k8s.io", Kind: "SelfSubjectReview"}:                       true,
+	{Group: "authentication.k8s.io", Kind: "TokenReview"}:                             true,
+	{Group: "authorization.k8s.io", Kind: "SelfSubjectAccessReview"}:                  true,
+	{Group: "authorization.k8s.io", Kind: "SelfSubjectRulesReview"}:                   true,
+	{Group: "authorization.k8s.io", Kind: "SubjectAccessReview"}:                      true,
+	{Group: "certificates.k8s.io", Kind: "CertificateSigningRequest"}:                 true,
+	{Group: "certificates.k8s.io", Kind: "ClusterTrustBundle"}:                        true,
+	{Group: "flowcontrol.apiserver.k8s.io", Kind: "FlowSchema"}:                       true,
+	{Group: "flowcontrol.apiserver.k8s.io", Kind: "PriorityLevelConfiguration"}:       true,
+	{Group: "internal.apiserver.k8s.io", Kind: "StorageVersion"}:                      true,
+	{Group: "networking.k8s.io", Kind: "IPAddress"}:                                   true,
+	{Group: "networking.k8s.io", Kind: "IngressClass"}:                                true,
+	{Group: "networking.k8s.io", Kind: "ServiceCIDR"}:                                 true,
+	{Group: "node.k8s.io", Kind: "RuntimeClass"}:                                      true,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"}:                         true,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"}:                  true,
+	{Group: "resource.k8s.io", Kind: "DeviceClass"}:                                   true,
+	{Group: "resource.k8s.io", Kind: "ResourceSlice"}:                                 true,
+	{Group: "scheduling.k8s.io", Kind: "PriorityClass"}:                               true,
+	{Group: "storage.k8s.io", Kind: "CSIDriver"}:                                      true,
+	{Group: "storage.k8s.io", Kind: "CSINode"}:                                        true,
+	{Group: "storage.k8s.io", Kind: "StorageClass"}:                                   true,
+	{Group: "storage.k8s.io", Kind: "VolumeAttachment"}:                               true,
+	{Group: "storage.k8s.io", Kind: "VolumeAttributesClass"}:                          true,
+	{Group: "storagemigration.k8s.io", Kind: "StorageVersionMigration"}:               true,
+}
+
+// unregisteredKinds are the built-in kinds that are not registered with the client-go scheme.
+var unregisteredKinds = []schema.GroupVersionKind{
+	{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"},
+	{Group: "apiregistration.k8s.io", Version: "v1", Kind: "APIService"},
+}
+
+// DefaultRESTMapper returns a new RESTMapper that knows the scope of the built-in kinds. The scope
+// of other kinds can be added to it with Add, and the mapper used with Cluster.SetRESTMapper.
+func DefaultRESTMapper() *meta.DefaultRESTMapper {
+	versions := scheme.Scheme.PrioritizedVersionsAllGroups()
+	for _, gvk := range unregisteredKinds {
+		versions = append(versions, gvk.GroupVersion())
+	}
+	mapper := meta.NewDefaultRESTMapper(versions)
+	for gvk := range scheme.Scheme.AllKnownTypes() {
+		if gvk.Version == runtime.APIVersionInternal {
+			continue
+		}
+		scope := meta.RESTScopeNamespace
+		if clusterScopedKinds[gvk.GroupKind()] {
+			scope = meta.RESTScopeRoot
+		}
+		mapper.Add(gvk, scope)
+	}
+	for _, gvk := range unregisteredKinds {
+		mapper.Add(gvk, meta.RESTScopeRoot)
+	}
+	return mapper
+}
+
+// SetRESTMapper sets the mapper used to find whether objects belong to a namespace, such as a
+// DefaultRESTMapper extended with custom resources, or a mapper built from a cluster's discovery
+// API. The scope of the custom resources defined by CustomResourceDefinitions in the cluster is
+// always known. By default, only the built-in kinds are known.
+func (c *Cluster) SetRESTMapper(mapper meta.RESTMapper) {
+	c.mapper = mapper
+}
+
+// restMapper returns the mapper for the kinds defined by the cluster's CustomResourceDefinitions,
+// falling back to the mapper set with SetRESTMapper or DefaultRESTMapper.
+func (c *Cluster) restMapper() meta.RESTMapper {
+	crds := meta.NewDefaultRESTMapper(nil)
+	for _, obj := range c.objects() {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok || u.GroupVersionKind().GroupKind() != (schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}) {
+			continue
+		}
+		group, _, _ := unstructured.NestedString(u.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(u.Object, "spec", "names", "kind")
+		scope, _, _ := unstructured.NestedString(u.Object, "spec", "scope")
+		versions, _, _ := unstructured.NestedSlice(u.Object, "spec", "versions")
+		for _, v := range versions {
+			version, _ := v.(map[string]interface{})["name"].(string)
+			gvk := schema.GroupVersionKind{Group: group, Version: version, Kind: kind}
+			switch scope {
+			case "Cluster":
+				crds.Add(gvk, meta.RESTScopeRoot)
+			case "Namespaced":
+				crds.Add(gvk, meta.RESTScopeNamespace)
+			}
+		}
+	}
+
+	mapper := c.mapper
+	if mapper == nil {
+		mapper = DefaultRESTMapper()
+	}
+	return meta.FirstHitRESTMapper{MultiRESTMapper: meta.MultiRESTMapper{crds, mapper}}
+}
+
+// namespaced reports whether obj belongs to a namespace according to mapper, and whether its kind
+// is known at all.
+func namespaced(mapper meta.RESTMapper, obj runtime.Object) (namespaced, known bool) {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		// The scope of a kind does not depend on its version
+		if mapping, err = mapper.RESTMapping(gvk.GroupKind()); err != nil {
+			return false, false
+		}
+	}
+	return mapping.Scope.Name() == meta.RESTScopeNameNamespace, true
+}
+
+// InDirectory returns a filter that selects the objects in files under dir.
+func (c *Cluster) InDirectory(dir string) Filter {
+	dir = filepath.Clean(dir) + string(filepath.Separator)
+	objs := make(map[Object]bool)
+	for file, docs := range c.files {
+		if strings.HasPrefix(filepath.Clean(file), dir) {
+			for _, doc := range docs {
+				objs[doc.obj.(Object)] = true
+			}
+		}
+	}
+	return func(obj Object) bool {
+		return objs[obj]
+	}
+}
+
+// SetNamespace moves the selected objects to namespace, and creates the Namespace if it does not
+// exist. Objects of kinds that do not belong to a namespace, such as ClusterRoles, are left
+// unchanged, as are objects of kinds whose scope is unknown: custom resources that are not
+// defined by a CustomResourceDefinition in the cluster or declared with SetRESTMapper.
+func (s *Selection) SetNamespace(namespace string) {
+	mapper := s.c.restMapper()
+	for _, obj := range s.objs {
+		if ns, known := namespaced(mapper, obj); ns && known {
+			obj.(Object).SetNamespace(namespace)
+			s.c.touch(obj)
+		}
+	}
+	s.c.EnsureNamespaces(namespace)
+}
+
+// NamespaceLabels merges labels into the namespace's labels.
+func NamespaceLabels(labels map[string]string) NamespaceOp {
+	return func(ns *kube.Namespace) {
+		if ns.Labels == nil {
+			ns.Labels = make(map[string]string)
+		}
+		for k, v := range labels {
+			ns.Labels[k] = v
+		}
+	}
+}
+
+// QuotaHard sets the hard limit of the quota on a resource, such as "requests.cpu" or "pods".
+func QuotaHard(name kube.ResourceName, quantity string) ResourceQuotaOp {
+	return func(quota *kube.ResourceQuota) {
+		q, err := resource.ParseQuantity(quantity)
+		if err != nil {
+			Fail(fmt.Sprintf("QuotaHard(%q, %q)", name, quantity), err)
+		}
+		if quota.Spec.Hard == nil {
+			quota.Spec.Hard = make(kube.ResourceList)
+		}
+		quota.Spec.Hard[name] = q
+	}
+}
+
+// RemoveQuotaHard removes the hard limit of the quota on a resource, if it exists.
+func RemoveQuotaHard(name kube.ResourceName) ResourceQuotaOp {
+	return func(quota *kube.ResourceQuota) {
+		delete(quota.Spec.Hard, name)
+	}
+}
+
+// ContainerDefaultRequests sets the CPU and memory requests of containers that do not set their
+// own.
+func ContainerDefaultRequests(cpu, memory string) LimitRangeOp {
+	return func(lr *kube.LimitRange) {
+		containerLimits(lr).DefaultRequest = resourceList(fmt.Sprintf("ContainerDefaultRequests(%q, %q)", cpu, memory), cpu, memory)
+	}
+}
+
+// ContainerDefaultLimits sets the CPU and memory limits of containers that do not set their own.
+func ContainerDefaultLimits(cpu, memory string) LimitRangeOp {
+	return func(lr *kube.LimitRange) {
+		containerLimits(lr).Default = resourceList(fmt.Sprintf("ContainerDefaultLimits(%q, %q)", cpu, memory), cpu, memory)
+	}
+}
+
+// ContainerMaxLimits sets the largest CPU and memory limits a container may have.
+func ContainerMaxLimits(cpu, memory string) LimitRangeOp {
+	return func(lr *kube.LimitRange) {
+		containerLimits(lr).Max = resourceList(fmt.Sprintf("ContainerMaxLimits(%q, %q)", cpu, memory), cpu, memory)
+	}
+}
+
+// containerLimits returns the limits of lr for containers, adding them if they do not exist.
+func containerLimits(lr *kube.LimitRange) *kube.LimitRangeItem {
+	for i := range lr.Spec.Limits {
+		if lr.Spec.Limits[i].Type == kube.LimitTypeContainer {
+			return &lr.Spec.Limits[i]
+		}
+	}
+	lr.Spec.Limits = append(lr.Spec.Limits, kube.LimitRangeItem{Type: kube.LimitTypeContainer})
+	return &lr.Spec.Limits[len(lr.Spec.Limits)-1]
+}
@@ -0,0 +1,37 @@
+package kg
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestDefaultRESTMapper(t *testing.T) {
+	mapper := DefaultRESTMapper()
+	for gk := range clusterScopedKinds {
+		mapping, err := mapper.RESTMapping(gk)
+		if err != nil {
+			t.Errorf("%s: %v", gk, err)
+			continue
+		}
+		if mapping.Scope.Name() != meta.RESTScopeNameRoot {
+			t.Errorf("expected %s to be cluster-scoped, got scope %s", gk, mapping.Scope.Name())
+		}
+	}
+	for _, gk := range []schema.GroupKind{
+		{Group: "", Kind: "ConfigMap"},
+		{Group: "apps", Kind: "Deployment"},
+		{Group: "storage.k8s.io", Kind: "CSIStorageCapacity"},
+		{Group: "rbac.authorization.k8s.io", Kind: "Role"},
+	} {
+		mapping, err := mapper.RESTMapping(gk)
+		if err != nil {
+			t.Errorf("%s: %v", gk, err)
+			continue
+		}
+		if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+			t.Errorf("expected %s to be namespaced, got scope %s", gk, mapping.Scope.Name())
+		}
+	}
+}
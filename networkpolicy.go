@@ -0,0 +1,185 @@
+package kg
+
+import (
+	"fmt"
+	"reflect"
+
+	kube "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+type NetworkPolicyOp func(np *networking.NetworkPolicy)
+
+func newNetworkPolicy(name string) *networking.NetworkPolicy {
+	return &networking.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: name}}
+}
+
+// DefaultDeny selects the NetworkPolicy named default-deny in each namespace, creating it if it
+// does not exist, and sets it to deny all ingress and egress traffic of every pod in the
+// namespace that no other policy allows.
+func (c *Cluster) DefaultDeny(namespaces ...string) NetworkPolicies {
+	selected := NetworkPolicies{c: c}
+	for _, namespace := range namespaces {
+		nps := c.selectOrCreateIn(namespace, "default-deny", func(name string) runtime.Object { return newNetworkPolicy(name) }).NetworkPolicies()
+		selected.Items = append(selected.Items, nps.Items...)
+	}
+	selected.Apply(DenyAll())
+	return selected
+}
+
+// AllowIngress allows traffic from the pods of each workload in from to the named container ports
+// of the pods of to. The rules are added to the NetworkPolicy with the same name and namespace as
+// to, which is created if it does not exist. If to has no named container ports, traffic to all
+// ports is allowed.
+func (c *Cluster) AllowIngress(to Workload, from ...Workload) NetworkPolicies {
+	nps := c.workloadPolicy(to)
+	ports := workloadPorts(to)
+	for _, peer := range from {
+		nps.Apply(allowIngressFrom(peer, ports))
+	}
+	return nps
+}
+
+// AllowEgress allows traffic from the pods of from to the named container ports of the pods of
+// each workload in to. The rules are added to the NetworkPolicy with the same name and namespace
+// as from, which is created if it does not exist.
+func (c *Cluster) AllowEgress(from Workload, to ...Workload) NetworkPolicies {
+	nps := c.workloadPolicy(from)
+	for _, peer := range to {
+		nps.Apply(allowEgressTo(peer, workloadPorts(peer)))
+	}
+	return nps
+}
+
+// workloadPolicy selects the NetworkPolicy for the pods of w, creating it if it does not exist.
+func (c *Cluster) workloadPolicy(w Workload) NetworkPolicies {
+	nps := c.selectOrCreateIn(w.GetNamespace(), w.GetName(), func(name string) runtime.Object { return newNetworkPolicy(name) }).NetworkPolicies()
+	nps.Apply(PolicyPods(w))
+	return nps
+}
+
+// DenyAll makes the policy select every pod in its namespace and removes its rules, so that it
+// denies all ingress and egress traffic that no other policy allows.
+func DenyAll() NetworkPolicyOp {
+	return func(np *networking.NetworkPolicy) {
+		np.Spec = networking.NetworkPolicySpec{
+			PolicyTypes: []networking.PolicyType{networking.PolicyTypeIngress, networking.PolicyTypeEgress},
+		}
+	}
+}
+
+// PolicyPods makes the policy apply to the pods of w, selected by the labels of its pod template.
+// It fails if the pod template has no labels.
+func PolicyPods(w Workload) NetworkPolicyOp {
+	return func(np *networking.NetworkPolicy) {
+		np.Spec.PodSelector = workloadSelector(fmt.Sprintf("PolicyPods(%s)", w.GetName()), w)
+	}
+}
+
+// AllowIngressFrom allows traffic from the pods of peer to the given named ports, or to all ports
+// if none are given. Ports use the TCP protocol. The ports of an existing rule for peer are
+// replaced. It fails if the pod template of peer has no labels.
+func AllowIngressFrom(peer Workload, ports ...string) NetworkPolicyOp {
+	return allowIngressFrom(peer, namedPorts(ports))
+}
+
+// AllowEgressTo allows traffic to the given named ports of the pods of peer, or to all ports if
+// none are given. Ports use the TCP protocol. The ports of an existing rule for peer are replaced.
+// It fails if the pod template of peer has no labels.
+func AllowEgressTo(peer Workload, ports ...string) NetworkPolicyOp {
+	return allowEgressTo(peer, namedPorts(ports))
+}
+
+func allowIngressFrom(peer Workload, ports []networking.NetworkPolicyPort) NetworkPolicyOp {
+	return func(np *networking.NetworkPolicy) {
+		peers := []networking.NetworkPolicyPeer{workloadPeer(fmt.Sprintf("AllowIngressFrom(%s)", peer.GetName()), np, peer)}
+		addPolicyType(np, networking.PolicyTypeIngress)
+		for i := range np.Spec.Ingress {
+			if reflect.DeepEqual(np.Spec.Ingress[i].From, peers) {
+				np.Spec.Ingress[i].Ports = ports
+				return
+			}
+		}
+		np.Spec.Ingress = append(np.Spec.Ingress, networking.NetworkPolicyIngressRule{From: peers, Ports: ports})
+	}
+}
+
+func allowEgressTo(peer Workload, ports []networking.NetworkPolicyPort) NetworkPolicyOp {
+	return func(np *networking.NetworkPolicy) {
+		peers := []networking.NetworkPolicyPeer{workloadPeer(fmt.Sprintf("AllowEgressTo(%s)", peer.GetName()), np, peer)}
+		addPolicyType(np, networking.PolicyTypeEgress)
+		for i := range np.Spec.Egress {
+			if reflect.DeepEqual(np.Spec.Egress[i].To, peers) {
+				np.Spec.Egress[i].Ports = ports
+				return
+			}
+		}
+		np.Spec.Egress = append(np.Spec.Egress, networking.NetworkPolicyEgressRule{To: peers, Ports: ports})
+	}
+}
+
+func addPolicyType(np *networking.NetworkPolicy, policyType networking.PolicyType) {
+	for _, t := range np.Spec.PolicyTypes {
+		if t == policyType {
+			return
+		}
+	}
+	np.Spec.PolicyTypes = append(np.Spec.PolicyTypes, policyType)
+}
+
+// workloadPeer returns the peer that selects the pods of w from a policy in np's namespace.
+func workloadPeer(op string, np *networking.NetworkPolicy, w Workload) networking.NetworkPolicyPeer {
+	selector := workloadSelector(op, w)
+	peer := networking.NetworkPolicyPeer{PodSelector: &selector}
+	if w.GetNamespace() != np.Namespace {
+		peer.NamespaceSelector = &metav1.LabelSelector{
+			MatchLabels: map[string]string{"kubernetes.io/metadata.name": w.GetNamespace()},
+		}
+	}
+	return peer
+}
+
+// workloadSelector returns the selector of the pods of w by the labels of its pod template. It
+// fails if there are none, since an empty selector would select every pod in the namespace.
+func workloadSelector(op string, w Workload) metav1.LabelSelector {
+	if len(w.Template.Labels) == 0 {
+		Fail(op, fmt.Errorf("pod template of %s has no labels", w.GetName()))
+	}
+	labels := make(map[string]string, len(w.Template.Labels))
+	for k, v := range w.Template.Labels {
+		labels[k] = v
+	}
+	return metav1.LabelSelector{MatchLabels: labels}
+}
+
+// workloadPorts returns the named container ports of the pods of w.
+func workloadPorts(w Workload) []networking.NetworkPolicyPort {
+	var ports []networking.NetworkPolicyPort
+	for _, c := range w.Template.Spec.Containers {
+		for _, p := range c.Ports {
+			if p.Name == "" {
+				continue
+			}
+			protocol := p.Protocol
+			if protocol == "" {
+				protocol = kube.ProtocolTCP
+			}
+			port := intstr.FromString(p.Name)
+			ports = append(ports, networking.NetworkPolicyPort{Protocol: &protocol, Port: &port})
+		}
+	}
+	return ports
+}
+
+func namedPorts(names []string) []networking.NetworkPolicyPort {
+	var ports []networking.NetworkPolicyPort
+	for _, name := range names {
+		protocol := kube.ProtocolTCP
+		port := intstr.FromString(name)
+		ports = append(ports, networking.NetworkPolicyPort{Protocol: &protocol, Port: &port})
+	}
+	return ports
+}
@@ -0,0 +1,329 @@
+package kg
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+
+	yaml "go.yaml.in/yaml/v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer/json"
+)
+
+// untyped returns the form of obj emitted by the Kubernetes serializer, decoded into maps, slices
+// and scalars. It is sanitized unless obj is unstructured.
+func untyped(obj runtime.Object) (map[string]interface{}, error) {
+	b, err := serialize(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	if _, ok := obj.(*unstructured.Unstructured); !ok {
+		sanitize(m)
+	}
+	return m, nil
+}
+
+func serialize(obj runtime.Object) ([]byte, error) {
+	e := json.NewYAMLSerializer(json.DefaultMetaFactory, nil, nil)
+
+	var buf bytes.Buffer
+	if err := e.Encode(obj, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodePatched serializes the object in doc by patching the fields that changed since it was
+// loaded into the document's original YAML. Comments, key order, quoting and unchanged fields are
+// preserved. Blank lines are only preserved if the object did not change at all.
+func encodePatched(doc *document) ([]byte, error) {
+	cur, err := untyped(doc.obj)
+	if err != nil {
+		return nil, err
+	}
+	if reflect.DeepEqual(cur, doc.orig) {
+		if !bytes.HasSuffix(doc.raw, []byte("\n")) {
+			return append(doc.raw, '\n'), nil
+		}
+		return doc.raw, nil
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal(doc.raw, &node); err != nil {
+		return nil, err
+	}
+	root := &node
+	if root.Kind == yaml.DocumentNode {
+		root = root.Content[0]
+	}
+
+	// The serializer's output determines where new keys are inserted
+	b, err := serialize(doc.obj)
+	if err != nil {
+		return nil, err
+	}
+	var canon yaml.Node
+	if err := yaml.Unmarshal(b, &canon); err != nil {
+		return nil, err
+	}
+
+	if err := patchNode(root, canon.Content[0], doc.orig, cur); err != nil {
+		return nil, err
+	}
+
+	indent, compact := detectIndent(root)
+	var buf bytes.Buffer
+	e := yaml.NewEncoder(&buf)
+	e.SetIndent(indent)
+	if compact {
+		e.CompactSeqIndent()
+	}
+	if err := e.Encode(&node); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// patchNode updates node, which holds the YAML form of from, so that it holds the YAML form of to.
+// Parts of the tree that are equal in from and to are left untouched. canon is the serializer's
+// form of to, or nil if unknown, and is used to order new mapping keys.
+func patchNode(node, canon *yaml.Node, from, to interface{}) error {
+	if reflect.DeepEqual(from, to) {
+		return nil
+	}
+	switch to := to.(type) {
+	case map[string]interface{}:
+		if from, ok := from.(map[string]interface{}); ok && node.Kind == yaml.MappingNode {
+			return patchMapping(node, canon, from, to)
+		}
+	case []interface{}:
+		if from, ok := from.([]interface{}); ok && node.Kind == yaml.SequenceNode && len(node.Content) == len(from) {
+			return patchSequence(node, canon, from, to)
+		}
+	}
+	return replaceNode(node, to)
+}
+
+func patchMapping(node, canon *yaml.Node, from, to map[string]interface{}) error {
+	// Remove deleted keys
+	for i := 0; i < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		_, inFrom := from[key]
+		_, inTo := to[key]
+		if inFrom && !inTo {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			i -= 2
+		}
+	}
+
+	// Update changed keys and append new ones
+	keys := make([]string, 0, len(to))
+	for key := range to {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fromV, inFrom := from[key]
+		toV := to[key]
+		if inFrom && reflect.DeepEqual(fromV, toV) {
+			continue
+		}
+
+		if i := mappingIndex(node, key); i >= 0 {
+			var err error
+			if inFrom {
+				err = patchNode(node.Content[i+1], canonValue(canon, key), fromV, toV)
+			} else {
+				// The key is in the source but was dropped by sanitize
+				err = replaceNode(node.Content[i+1], toV)
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// The key is new, or was filled in by the serializer rather than present in the source
+		keyNode, err := newNode(key)
+		if err != nil {
+			return err
+		}
+		valueNode, err := newNode(toV)
+		if err != nil {
+			return err
+		}
+		i := insertIndex(node, canon, key)
+		node.Content = append(node.Content[:i], append([]*yaml.Node{keyNode, valueNode}, node.Content[i:]...)...)
+	}
+	return nil
+}
+
+// insertIndex returns the index in node.Content at which to insert key: after the last key of node
+// that precedes key in canon, or at the end if canon is unknown. Keys of canon that node lacks,
+// such as the empty maps the serializer always emits, are skipped.
+func insertIndex(node, canon *yaml.Node, key string) int {
+	if canon == nil || canon.Kind != yaml.MappingNode {
+		return len(node.Content)
+	}
+	index := 0
+	for i := 0; i < len(canon.Content) && canon.Content[i].Value != key; i += 2 {
+		if j := mappingIndex(node, canon.Content[i].Value); j >= 0 && j+2 > index {
+			index = j + 2
+		}
+	}
+	return index
+}
+
+// canonValue returns the value of key in canon, or nil.
+func canonValue(canon *yaml.Node, key string) *yaml.Node {
+	if canon == nil || canon.Kind != yaml.MappingNode {
+		return nil
+	}
+	if i := mappingIndex(canon, key); i >= 0 {
+		return canon.Content[i+1]
+	}
+	return nil
+}
+
+// mappingIndex returns the index in node.Content of the key node for key, or -1.
+func mappingIndex(node *yaml.Node, key string) int {
+	for i := 0; i < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// patchSequence patches a sequence whose elements node.Content correspond one-to-one to from.
+// Elements are matched by their "name" field where they have one, so that inserting or removing
+// a container, port, env var, etc. doesn't rewrite its siblings.
+func patchSequence(node, canon *yaml.Node, from, to []interface{}) error {
+	used := make([]bool, len(from))
+	content := make([]*yaml.Node, 0, len(to))
+	for i, toV := range to {
+		j := matchElement(from, used, toV, i)
+		if j < 0 {
+			n, err := newNode(toV)
+			if err != nil {
+				return err
+			}
+			content = append(content, n)
+			continue
+		}
+		used[j] = true
+		var canonElem *yaml.Node
+		if canon != nil && canon.Kind == yaml.SequenceNode && i < len(canon.Content) {
+			canonElem = canon.Content[i]
+		}
+		if err := patchNode(node.Content[j], canonElem, from[j], toV); err != nil {
+			return err
+		}
+		content = append(content, node.Content[j])
+	}
+	node.Content = content
+	return nil
+}
+
+// matchElement returns the index of the unused element of from that corresponds to v, the
+// element at index i of the new sequence, or -1 if there is none.
+func matchElement(from []interface{}, used []bool, v interface{}, i int) int {
+	if name, ok := elementName(v); ok {
+		for j := range from {
+			if fromName, ok := elementName(from[j]); ok && !used[j] && fromName == name {
+				return j
+			}
+		}
+		return -1
+	}
+	for j := range from {
+		if !used[j] && reflect.DeepEqual(from[j], v) {
+			return j
+		}
+	}
+	if i < len(from) && !used[i] {
+		if _, ok := elementName(from[i]); !ok {
+			return i
+		}
+	}
+	return -1
+}
+
+func elementName(v interface{}) (string, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	name, ok := m["name"].(string)
+	return name, ok
+}
+
+// replaceNode replaces node with the YAML form of v, keeping node's comments and, if the scalar
+// type is unchanged, its quoting style.
+func replaceNode(node *yaml.Node, v interface{}) error {
+	n, err := newNode(v)
+	if err != nil {
+		return err
+	}
+	if n.Kind == yaml.ScalarNode && node.Kind == yaml.ScalarNode && n.Tag == node.ShortTag() {
+		n.Style = node.Style
+	}
+	n.HeadComment, n.LineComment, n.FootComment = node.HeadComment, node.LineComment, node.FootComment
+	*node = *n
+	return nil
+}
+
+func newNode(v interface{}) (*yaml.Node, error) {
+	var n yaml.Node
+	if err := n.Encode(v); err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// detectIndent returns the indentation width of node's block mappings and whether its block
+// sequences are indented compactly, with "- " at the same column as the parent key (the style
+// used by kubectl). The defaults are 2 and true.
+func detectIndent(node *yaml.Node) (indent int, compact bool) {
+	indent, compact = 0, true
+	foundSeq := false
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		if n.Kind == yaml.MappingNode && n.Style&yaml.FlowStyle == 0 {
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				key, value := n.Content[i], n.Content[i+1]
+				if value.Style&yaml.FlowStyle != 0 || len(value.Content) == 0 {
+					continue
+				}
+				switch value.Kind {
+				case yaml.MappingNode:
+					if indent == 0 {
+						indent = value.Content[0].Column - key.Column
+					}
+				case yaml.SequenceNode:
+					if !foundSeq {
+						compact = value.Column == key.Column
+						foundSeq = true
+					}
+				}
+			}
+		}
+		for _, child := range n.Content {
+			walk(child)
+		}
+	}
+	walk(node)
+	if indent < 2 {
+		indent = 2
+	}
+	return indent, compact
+}
@@ -0,0 +1,62 @@
+package kg
+
+import (
+	"fmt"
+
+	policy "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+type PodDisruptionBudgetOp func(pdb *policy.PodDisruptionBudget)
+
+func newPodDisruptionBudget(name string) *policy.PodDisruptionBudget {
+	return &policy.PodDisruptionBudget{ObjectMeta: metav1.ObjectMeta{Name: name}}
+}
+
+// ProtectWorkload selects the PodDisruptionBudget with the same name and namespace as w, creating it
+// if it does not exist, and sets it to select the pods of w by the labels of its pod template. The budget
+// itself is set with MinAvailable or MaxUnavailable.
+func (c *Cluster) ProtectWorkload(w Workload) PodDisruptionBudgets {
+	pdbs := c.selectOrCreateIn(w.GetNamespace(), w.GetName(), func(name string) runtime.Object { return newPodDisruptionBudget(name) }).PodDisruptionBudgets()
+	pdbs.Apply(func(pdb *policy.PodDisruptionBudget) {
+		if len(w.Template.Labels) == 0 {
+			Fail(fmt.Sprintf("ProtectWorkload(%s)", w.GetName()), fmt.Errorf("pod template has no labels"))
+		}
+		labels := make(map[string]string, len(w.Template.Labels))
+		for k, v := range w.Template.Labels {
+			labels[k] = v
+		}
+		pdb.Spec.Selector = &metav1.LabelSelector{MatchLabels: labels}
+	})
+	return pdbs
+}
+
+// MinAvailable sets the number of pods that must remain available during voluntary disruptions,
+// either a count such as "2" or a percentage such as "50%". It removes maxUnavailable, which
+// cannot be set at the same time.
+func MinAvailable(value string) PodDisruptionBudgetOp {
+	return func(pdb *policy.PodDisruptionBudget) {
+		pdb.Spec.MinAvailable = disruptionBudget(fmt.Sprintf("MinAvailable(%q)", value), value)
+		pdb.Spec.MaxUnavailable = nil
+	}
+}
+
+// MaxUnavailable sets the number of pods that may be unavailable during voluntary disruptions,
+// either a count such as "1" or a percentage such as "25%". It removes minAvailable, which cannot
+// be set at the same time.
+func MaxUnavailable(value string) PodDisruptionBudgetOp {
+	return func(pdb *policy.PodDisruptionBudget) {
+		pdb.Spec.MaxUnavailable = disruptionBudget(fmt.Sprintf("MaxUnavailable(%q)", value), value)
+		pdb.Spec.MinAvailable = nil
+	}
+}
+
+func disruptionBudget(op, value string) *intstr.IntOrString {
+	v := intstr.Parse(value)
+	if _, err := intstr.GetScaledValueFromIntOrPercent(&v, 100, false); err != nil {
+		Fail(op, err)
+	}
+	return &v
+}
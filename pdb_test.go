@@ -0,0 +1,28 @@
+package kg
+
+import (
+	"strings"
+	"testing"
+
+	policy "k8s.io/api/policy/v1"
+)
+
+func TestDisruptionBudgetOps(t *testing.T) {
+	pdb := newPodDisruptionBudget("api")
+	pdbs := PodDisruptionBudgets{Items: []*policy.PodDisruptionBudget{pdb}}
+	pdbs.Apply(MaxUnavailable("1"), MinAvailable("50%"))
+	if pdb.Spec.MinAvailable.String() != "50%" || pdb.Spec.MaxUnavailable != nil {
+		t.Errorf("expected minAvailable 50%% to replace maxUnavailable, got %+v", pdb.Spec)
+	}
+	pdbs.Apply(MaxUnavailable("2"))
+	if pdb.Spec.MaxUnavailable.String() != "2" || pdb.Spec.MinAvailable != nil {
+		t.Errorf("expected maxUnavailable 2 to replace minAvailable, got %+v", pdb.Spec)
+	}
+
+	defer func() {
+		if err, _ := recover().(*OpError); err == nil || !strings.Contains(err.Error(), `MinAvailable("half")`) {
+			t.Errorf("expected MinAvailable to fail, got %v", err)
+		}
+	}()
+	pdbs.Apply(MinAvailable("half"))
+}
@@ -0,0 +1,152 @@
+package kg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	yaml "gopkg.in/yaml.v2"
+	kube "k8s.io/api/core/v1"
+)
+
+// pinnedImageAnnotation is the prefix of the annotations in which PinImages records the image
+// reference each container had before it was pinned, together with the digest it was pinned to,
+// keyed by container name.
+const pinnedImageAnnotation = "image.kg.sourcegraph.com/"
+
+// ReadImageLock reads an images lockfile, a YAML or JSON map from image reference to digest:
+//
+//	nginx:1.21: sha256:...
+//	gcr.io/project/app:v1: sha256:...
+func ReadImageLock(filename string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var lock map[string]string
+	if err := yaml.Unmarshal(b, &lock); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return lock, nil
+}
+
+// PinImages pins the image of every container and init container of every workload in the
+// cluster to its digest in lock, a map from image reference to digest such as one read by
+// ReadImageLock. Images are rewritten to repository@digest, and the reference each container had
+// and the digest it was pinned to are kept in the workload's annotation
+// image.kg.sourcegraph.com/${container}, e.g. "nginx:1.21@sha256:...", so that running PinImages
+// again with an updated lockfile repins them. References are matched regardless of Docker Hub's
+// implicit registry, so "nginx:1.21" matches "docker.io/library/nginx:1.21". Images that already
+// have a digest are left unchanged, unless PinImages pinned them: if a pinned image has since been
+// set to another digest, the explicit digest is kept and the annotation removed.
+//
+// Images missing from lock are recorded as a MissingImagesError. It returns every image it
+// changed.
+func (c *Cluster) PinImages(lock map[string]string) []ImageChange {
+	digests := make(map[string]string, len(lock))
+	for image, digest := range lock {
+		ref, err := parseImage(image)
+		if err == nil && !digestPattern.MatchString(digest) {
+			err = fmt.Errorf("invalid digest %q for image %q", digest, image)
+		}
+		if err != nil {
+			c.errs = append(c.errs, fmt.Errorf("PinImages: %v", err))
+			return nil
+		}
+		digests[lockKey(ref)] = digest
+	}
+
+	var changes []ImageChange
+	missing := make(map[string]bool)
+	for _, obj := range c.objects() {
+		w, ok := workload(obj)
+		if !ok {
+			continue
+		}
+		c.runOp(w.Object, func() {
+			spec := &w.Template.Spec
+			for _, containers := range [][]kube.Container{spec.InitContainers, spec.Containers} {
+				for i := range containers {
+					container := &containers[i]
+					if container.Image == "" {
+						continue
+					}
+					cur, err := parseImage(container.Image)
+					if err != nil {
+						Fail("PinImages", fmt.Errorf("container %s: %v", container.Name, err))
+					}
+					// A pinned image is repinned from the reference it had before
+					key := pinnedImageAnnotation + container.Name
+					ref := cur
+					if cur.Digest != "" {
+						annotation, ok := w.GetAnnotations()[key]
+						if !ok {
+							continue
+						}
+						pinned, err := parseImage(annotation)
+						if err != nil {
+							Fail("PinImages", fmt.Errorf("container %s: annotation %s: %v", container.Name, key, err))
+						}
+						if container.Image != (imageRef{Registry: pinned.Registry, Repository: pinned.Repository, Digest: pinned.Digest}).String() {
+							// The image was changed since it was pinned, so the annotation is stale
+							annotations := w.GetAnnotations()
+							delete(annotations, key)
+							w.SetAnnotations(annotations)
+							c.touch(obj)
+							continue
+						}
+						ref = pinned
+					}
+					ref.Digest = ""
+					digest, ok := digests[lockKey(ref)]
+					if !ok {
+						missing[ref.String()] = true
+						continue
+					}
+
+					pinnedRef := imageRef{Registry: ref.Registry, Repository: ref.Repository, Digest: digest}
+					if container.Image == pinnedRef.String() {
+						continue
+					}
+					changes = append(changes, ImageChange{
+						Kind:      w.GetObjectKind().GroupVersionKind().Kind,
+						Namespace: w.GetNamespace(),
+						Name:      w.GetName(),
+						Container: container.Name,
+						From:      container.Image,
+						To:        pinnedRef.String(),
+					})
+					container.Image = pinnedRef.String()
+					annotations := w.GetAnnotations()
+					if annotations == nil {
+						annotations = make(map[string]string)
+					}
+					ref.Digest = digest
+					annotations[key] = ref.String()
+					w.SetAnnotations(annotations)
+					c.touch(obj)
+				}
+			}
+		})
+	}
+
+	if len(missing) > 0 {
+		err := &MissingImagesError{}
+		for image := range missing {
+			err.Images = append(err.Images, image)
+		}
+		sort.Strings(err.Images)
+		c.errs = append(c.errs, err)
+	}
+	return changes
+}
+
+// lockKey returns the key by which ref is looked up in a lockfile: its name with Docker Hub's
+// implicit registry filled in, and its tag, which defaults to latest.
+func lockKey(ref imageRef) string {
+	tag := ref.Tag
+	if tag == "" {
+		tag = "latest"
+	}
+	return ref.name() + ":" + tag
+}
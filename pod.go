@@ -1,6 +1,10 @@
 package kg
 
-import kube "k8s.io/api/core/v1"
+import (
+	"fmt"
+
+	kube "k8s.io/api/core/v1"
+)
 
 func PodSpec(ops ...PodSpecOp) *kube.PodSpec {
 	pod := &kube.PodSpec{}
@@ -31,32 +35,101 @@ func NodeSelector(nodeSelector map[string]string) PodSpecOp {
 
 func Container(name string, ops ...ContainerOp) PodSpecOp {
 	return func(pod *kube.PodSpec) {
-		var containers []*kube.Container
-		if name == "" {
-			for i := range pod.Containers {
-				containers = append(containers, &pod.Containers[i])
-			}
-		} else {
-			for i, c := range pod.Containers {
-				if c.Name == name {
-					containers = []*kube.Container{&pod.Containers[i]}
-					break
-				}
-			}
-			if len(containers) == 0 {
-				pod.Containers = append(pod.Containers, kube.Container{
-					Name: name,
-				})
-				containers = []*kube.Container{&pod.Containers[len(pod.Containers)-1]}
-			}
+		applyContainerOps(pod, &pod.Containers, name, ops)
+	}
+}
+
+// InitContainer is like Container, but applies ops to the init container with the given name, or
+// to every init container if name is "". Init containers run in order, which can be changed with
+// Before and After.
+func InitContainer(name string, ops ...ContainerOp) PodSpecOp {
+	return func(pod *kube.PodSpec) {
+		applyContainerOps(pod, &pod.InitContainers, name, ops)
+	}
+}
+
+// Sidecar is like InitContainer, but makes the init container a native sidecar, which starts
+// before the containers of the pod and keeps running alongside them.
+func Sidecar(name string, ops ...ContainerOp) PodSpecOp {
+	return InitContainer(name, append([]ContainerOp{restartAlways}, ops...)...)
+}
+
+func restartAlways(pod *kube.PodSpec, container *kube.Container) {
+	policy := kube.ContainerRestartPolicyAlways
+	container.RestartPolicy = &policy
+}
+
+// applyContainerOps applies ops to the container in containers with the given name, adding it if
+// it does not exist, or to every container if name is "". Containers are looked up by name before
+// each op, so ops may reorder them.
+func applyContainerOps(pod *kube.PodSpec, containers *[]kube.Container, name string, ops []ContainerOp) {
+	var names []string
+	if name == "" {
+		for _, c := range *containers {
+			names = append(names, c.Name)
+		}
+	} else {
+		if containerIndex(*containers, name) < 0 {
+			*containers = append(*containers, kube.Container{
+				Name: name,
+			})
+		}
+		names = []string{name}
+	}
+
+	for _, name := range names {
+		for _, op := range ops {
+			op(pod, &(*containers)[containerIndex(*containers, name)])
 		}
+	}
+}
 
-		for _, container := range containers {
-			for _, op := range ops {
-				op(pod, container)
-			}
+// containerIndex returns the index of the container with the given name, or -1.
+func containerIndex(containers []kube.Container, name string) int {
+	for i := range containers {
+		if containers[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Before moves the container to just before the container named other, which must be in the same
+// list of containers or init containers.
+func Before(other string) ContainerOp {
+	return func(pod *kube.PodSpec, container *kube.Container) {
+		moveContainer(fmt.Sprintf("Before(%q)", other), pod, container, other, 0)
+	}
+}
+
+// After moves the container to just after the container named other, which must be in the same
+// list of containers or init containers.
+func After(other string) ContainerOp {
+	return func(pod *kube.PodSpec, container *kube.Container) {
+		moveContainer(fmt.Sprintf("After(%q)", other), pod, container, other, 1)
+	}
+}
+
+// moveContainer moves container to offset positions after the container named other.
+func moveContainer(op string, pod *kube.PodSpec, container *kube.Container, other string, offset int) {
+	containers := &pod.Containers
+	for i := range pod.InitContainers {
+		if &pod.InitContainers[i] == container {
+			containers = &pod.InitContainers
 		}
 	}
+	if container.Name == other {
+		Fail(op, fmt.Errorf("container %s cannot be moved relative to itself", other))
+	}
+	if containerIndex(*containers, other) < 0 {
+		Fail(op, fmt.Errorf("no container named %s", other))
+	}
+
+	moved := *container
+	i := containerIndex(*containers, moved.Name)
+	*containers = append((*containers)[:i], (*containers)[i+1:]...)
+	j := containerIndex(*containers, other) + offset
+	*containers = append((*containers)[:j], append([]kube.Container{moved}, (*containers)[j:]...)...)
 }
 
 func Volume(name string, source kube.VolumeSource) PodSpecOp {
@@ -0,0 +1,40 @@
+package kg
+
+import (
+	"reflect"
+	"testing"
+
+	kube "k8s.io/api/core/v1"
+)
+
+func TestInitContainerOrder(t *testing.T) {
+	ops := []PodSpecOp{
+		InitContainer("migrate", Args("up")),
+		InitContainer("wait", Before("migrate")),
+		Sidecar("proxy", After("wait"), Args("--port=8080")),
+		Container("app", Args("serve")),
+	}
+
+	once := PodSpec(ops...)
+	twice := PodSpec(append(ops, ops...)...)
+	if !reflect.DeepEqual(once, twice) {
+		t.Errorf("expected applying ops twice to be a no-op, got\n%+v\nand\n%+v", once, twice)
+	}
+
+	var names []string
+	for _, c := range once.InitContainers {
+		names = append(names, c.Name)
+	}
+	if exp := []string{"wait", "proxy", "migrate"}; !reflect.DeepEqual(names, exp) {
+		t.Errorf("expected init containers %v, got %v", exp, names)
+	}
+	if policy := once.InitContainers[1].RestartPolicy; policy == nil || *policy != kube.ContainerRestartPolicyAlways {
+		t.Errorf("expected proxy to be a sidecar, got restart policy %v", policy)
+	}
+	if args := once.InitContainers[1].Args; !reflect.DeepEqual(args, []string{"--port=8080"}) {
+		t.Errorf("expected ops after After to apply to proxy, got args %v", args)
+	}
+	if n := len(once.Containers); n != 1 {
+		t.Errorf("expected 1 container, got %d", n)
+	}
+}
@@ -0,0 +1,50 @@
+package kg
+
+import (
+	"fmt"
+
+	kube "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type PersistentVolumeOp func(pv *kube.PersistentVolume)
+
+func newPersistentVolume(name string) *kube.PersistentVolume {
+	return &kube.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: name}}
+}
+
+// Capacity sets the storage capacity of the volume, e.g. "100Gi".
+func Capacity(size string) PersistentVolumeOp {
+	return func(pv *kube.PersistentVolume) {
+		q, err := resource.ParseQuantity(size)
+		if err != nil {
+			Fail(fmt.Sprintf("Capacity(%q)", size), err)
+		}
+		if pv.Spec.Capacity == nil {
+			pv.Spec.Capacity = make(kube.ResourceList)
+		}
+		pv.Spec.Capacity[kube.ResourceStorage] = q
+	}
+}
+
+// ReclaimPolicy sets what happens to the volume when its claim is deleted:
+// kube.PersistentVolumeReclaimRetain, kube.PersistentVolumeReclaimDelete or
+// kube.PersistentVolumeReclaimRecycle.
+func ReclaimPolicy(policy kube.PersistentVolumeReclaimPolicy) PersistentVolumeOp {
+	return func(pv *kube.PersistentVolume) {
+		switch policy {
+		case kube.PersistentVolumeReclaimRetain, kube.PersistentVolumeReclaimDelete, kube.PersistentVolumeReclaimRecycle:
+		default:
+			Fail(fmt.Sprintf("ReclaimPolicy(%q)", policy), fmt.Errorf("unknown reclaim policy"))
+		}
+		pv.Spec.PersistentVolumeReclaimPolicy = policy
+	}
+}
+
+// VolumeStorageClass sets the name of the StorageClass the volume belongs to.
+func VolumeStorageClass(name string) PersistentVolumeOp {
+	return func(pv *kube.PersistentVolume) {
+		pv.Spec.StorageClassName = name
+	}
+}
@@ -0,0 +1,45 @@
+package kg
+
+import (
+	"strings"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+)
+
+func TestPersistentVolumeOps(t *testing.T) {
+	pv := newPersistentVolume("data")
+	pv.Spec.AccessModes = []core.PersistentVolumeAccessMode{core.ReadWriteOnce}
+	pvs := PersistentVolumes{Items: []*core.PersistentVolume{pv}}
+	pvs.Apply(Capacity("100Gi"), ReclaimPolicy(core.PersistentVolumeReclaimRetain), VolumeStorageClass("ssd"))
+
+	if q := pv.Spec.Capacity[core.ResourceStorage]; q.String() != "100Gi" {
+		t.Errorf("expected capacity 100Gi, got %s", q.String())
+	}
+	if pv.Spec.PersistentVolumeReclaimPolicy != core.PersistentVolumeReclaimRetain || pv.Spec.StorageClassName != "ssd" {
+		t.Errorf("expected reclaim policy Retain and storage class ssd, got %+v", pv.Spec)
+	}
+	if n := len(pv.Spec.AccessModes); n != 1 {
+		t.Errorf("expected the access modes to be kept, got %d", n)
+	}
+
+	for _, test := range []struct {
+		op   PersistentVolumeOp
+		desc string
+	}{
+		{Capacity("lots"), `Capacity("lots")`},
+		{ReclaimPolicy("Archive"), `ReclaimPolicy("Archive")`},
+	} {
+		func() {
+			defer func() {
+				if err, _ := recover().(*OpError); err == nil || !strings.Contains(err.Error(), test.desc) {
+					t.Errorf("expected %s to fail, got %v", test.desc, err)
+				}
+			}()
+			pvs.Apply(test.op)
+		}()
+	}
+	if pv.Spec.PersistentVolumeReclaimPolicy != core.PersistentVolumeReclaimRetain {
+		t.Errorf("expected the failed op not to change the reclaim policy, got %q", pv.Spec.PersistentVolumeReclaimPolicy)
+	}
+}
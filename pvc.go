@@ -1,14 +1,28 @@
 package kg
 
 import (
+	"fmt"
+
 	kube "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 type PersistentVolumeClaimOp func(pvc *kube.PersistentVolumeClaim)
 
+func newPersistentVolumeClaim(name string) *kube.PersistentVolumeClaim {
+	return &kube.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: name}}
+}
+
 func DiskSize(size string) PersistentVolumeClaimOp {
 	return func(pvc *kube.PersistentVolumeClaim) {
-		pvc.Spec.Resources.Requests[kube.ResourceStorage] = resource.MustParse(size)
+		q, err := resource.ParseQuantity(size)
+		if err != nil {
+			Fail(fmt.Sprintf("DiskSize(%q)", size), err)
+		}
+		if pvc.Spec.Resources.Requests == nil {
+			pvc.Spec.Resources.Requests = make(kube.ResourceList)
+		}
+		pvc.Spec.Resources.Requests[kube.ResourceStorage] = q
 	}
 }
@@ -0,0 +1,208 @@
+package kg
+
+import (
+	"reflect"
+	"strings"
+
+	rbac "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func RoleBinding(name string) *rbac.RoleBinding {
+	return &rbac.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+	}
+}
+
+func ClusterRoleBinding(name string) *rbac.ClusterRoleBinding {
+	return &rbac.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+	}
+}
+
+// PolicyRuleOp modifies the rules of a Role or ClusterRole.
+type PolicyRuleOp func(rules *[]rbac.PolicyRule)
+
+// PolicyRule adds rule unless an existing rule already grants everything it grants, taking the
+// wildcard "*" into account. Otherwise a rule for the same API groups, resource names and
+// non-resource URLs is extended rather than duplicated: its verbs are merged if it covers the same
+// resources, and its resources are merged if it allows the same verbs.
+func PolicyRule(rule rbac.PolicyRule) PolicyRuleOp {
+	return func(rules *[]rbac.PolicyRule) {
+		for _, r := range *rules {
+			if coversRule(r, rule) {
+				return
+			}
+		}
+		for i := range *rules {
+			r := &(*rules)[i]
+			if !sameStrings(r.APIGroups, rule.APIGroups) || !sameStrings(r.ResourceNames, rule.ResourceNames) || !sameStrings(r.NonResourceURLs, rule.NonResourceURLs) {
+				continue
+			}
+			if sameStrings(r.Resources, rule.Resources) {
+				r.Verbs = mergeStrings(r.Verbs, rule.Verbs)
+				return
+			}
+			if sameStrings(r.Verbs, rule.Verbs) {
+				r.Resources = mergeStrings(r.Resources, rule.Resources)
+				return
+			}
+		}
+		*rules = append(*rules, *rule.DeepCopy())
+	}
+}
+
+// coversRule reports whether r grants everything that rule grants.
+func coversRule(r, rule rbac.PolicyRule) bool {
+	if !coversAll(r.APIGroups, rule.APIGroups, exactOrWildcard) ||
+		!coversAll(r.Resources, rule.Resources, coversResource) ||
+		!coversAll(r.Verbs, rule.Verbs, exactOrWildcard) ||
+		!coversAll(r.NonResourceURLs, rule.NonResourceURLs, coversURL) {
+		return false
+	}
+	// A rule without resource names applies to all of them
+	if len(r.ResourceNames) == 0 {
+		return true
+	}
+	return len(rule.ResourceNames) > 0 && coversAll(r.ResourceNames, rule.ResourceNames, exactOrWildcard)
+}
+
+// coversAll reports whether every string of b is covered by some string of a.
+func coversAll(a, b []string, covers func(pattern, s string) bool) bool {
+	for _, s := range b {
+		found := false
+		for _, pattern := range a {
+			if covers(pattern, s) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func exactOrWildcard(pattern, s string) bool {
+	return pattern == s || pattern == rbac.VerbAll
+}
+
+// coversResource reports whether the resource pattern matches resource, where "*/scale" matches
+// the scale subresource of any resource.
+func coversResource(pattern, resource string) bool {
+	if exactOrWildcard(pattern, resource) {
+		return true
+	}
+	if strings.HasPrefix(pattern, "*/") {
+		i := strings.Index(resource, "/")
+		return i >= 0 && resource[i:] == pattern[1:]
+	}
+	return false
+}
+
+// coversURL reports whether the non-resource URL pattern matches url, where a trailing "*"
+// matches any suffix.
+func coversURL(pattern, url string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(url, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == url
+}
+
+// RemovePolicyRule removes the rules equal to rule.
+func RemovePolicyRule(rule rbac.PolicyRule) PolicyRuleOp {
+	return func(rules *[]rbac.PolicyRule) {
+		kept := (*rules)[:0]
+		for _, r := range *rules {
+			if !reflect.DeepEqual(r, rule) {
+				kept = append(kept, r)
+			}
+		}
+		*rules = kept
+	}
+}
+
+// BindingOp modifies the subjects and role reference of a RoleBinding or ClusterRoleBinding.
+type BindingOp func(subjects *[]rbac.Subject, roleRef *rbac.RoleRef)
+
+// BindRole makes the binding grant the Role with the given name.
+func BindRole(name string) BindingOp {
+	return func(subjects *[]rbac.Subject, roleRef *rbac.RoleRef) {
+		*roleRef = rbac.RoleRef{APIGroup: rbac.GroupName, Kind: "Role", Name: name}
+	}
+}
+
+// BindClusterRole makes the binding grant the ClusterRole with the given name.
+func BindClusterRole(name string) BindingOp {
+	return func(subjects *[]rbac.Subject, roleRef *rbac.RoleRef) {
+		*roleRef = rbac.RoleRef{APIGroup: rbac.GroupName, Kind: "ClusterRole", Name: name}
+	}
+}
+
+// Subject adds subject to the binding if it is not already a subject.
+func Subject(subject rbac.Subject) BindingOp {
+	return func(subjects *[]rbac.Subject, roleRef *rbac.RoleRef) {
+		for _, s := range *subjects {
+			if s.Kind == subject.Kind && s.Name == subject.Name && s.Namespace == subject.Namespace {
+				return
+			}
+		}
+		*subjects = append(*subjects, subject)
+	}
+}
+
+// ServiceAccountSubject adds the service account with the given namespace and name to the
+// binding's subjects.
+func ServiceAccountSubject(namespace, name string) BindingOp {
+	return Subject(rbac.Subject{Kind: rbac.ServiceAccountKind, Namespace: namespace, Name: name})
+}
+
+// RemoveSubject removes the subjects with the same kind, namespace and name as subject.
+func RemoveSubject(subject rbac.Subject) BindingOp {
+	return func(subjects *[]rbac.Subject, roleRef *rbac.RoleRef) {
+		kept := (*subjects)[:0]
+		for _, s := range *subjects {
+			if s.Kind != subject.Kind || s.Name != subject.Name || s.Namespace != subject.Namespace {
+				kept = append(kept, s)
+			}
+		}
+		*subjects = kept
+	}
+}
+
+// sameStrings reports whether a and b contain the same strings, ignoring order and duplicates.
+func sameStrings(a, b []string) bool {
+	return reflect.DeepEqual(stringSet(a), stringSet(b))
+}
+
+func stringSet(strs []string) map[string]bool {
+	set := make(map[string]bool, len(strs))
+	for _, s := range strs {
+		set[s] = true
+	}
+	return set
+}
+
+// mergeStrings returns a copy of a with the strings of b that are not in a appended. Neither a
+// nor b is modified.
+func mergeStrings(a, b []string) []string {
+	a = append([]string(nil), a...)
+	for _, s := range b {
+		found := false
+		for _, t := range a {
+			if s == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			a = append(a, s)
+		}
+	}
+	return a
+}
@@ -0,0 +1,96 @@
+package kg
+
+import (
+	"reflect"
+	"testing"
+
+	rbac "k8s.io/api/rbac/v1"
+)
+
+func TestPolicyRule(t *testing.T) {
+	pods := rbac.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}
+	tests := []struct {
+		rule rbac.PolicyRule
+		exp  []rbac.PolicyRule
+	}{{
+		rule: pods,
+		exp:  []rbac.PolicyRule{pods},
+	}, {
+		rule: rbac.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"list", "get"}},
+		exp:  []rbac.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}}},
+	}, {
+		rule: rbac.PolicyRule{APIGroups: []string{""}, Resources: []string{"services"}, Verbs: []string{"get"}},
+		exp:  []rbac.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods", "services"}, Verbs: []string{"get"}}},
+	}, {
+		rule: rbac.PolicyRule{APIGroups: []string{""}, Resources: []string{"services"}, Verbs: []string{"delete"}},
+		exp:  []rbac.PolicyRule{pods, {APIGroups: []string{""}, Resources: []string{"services"}, Verbs: []string{"delete"}}},
+	}, {
+		rule: rbac.PolicyRule{APIGroups: []string{"apps"}, Resources: []string{"pods"}, Verbs: []string{"get"}},
+		exp:  []rbac.PolicyRule{pods, {APIGroups: []string{"apps"}, Resources: []string{"pods"}, Verbs: []string{"get"}}},
+	}, {
+		// Covered by the existing rule
+		rule: rbac.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, ResourceNames: []string{"web"}, Verbs: []string{"get"}},
+		exp:  []rbac.PolicyRule{pods},
+	}}
+
+	for _, test := range tests {
+		role := Role("test", rbac.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}})
+		Roles{Items: []*rbac.Role{role}}.Apply(PolicyRule(test.rule), PolicyRule(test.rule))
+		if !reflect.DeepEqual(role.Rules, test.exp) {
+			t.Errorf("adding rule %+v: expected %+v but got %+v", test.rule, test.exp, role.Rules)
+		}
+	}
+}
+
+func TestPolicyRuleCovered(t *testing.T) {
+	admin := rbac.PolicyRule{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"}}
+	tests := []struct {
+		existing rbac.PolicyRule
+		rule     rbac.PolicyRule
+		covered  bool
+	}{
+		{admin, rbac.PolicyRule{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"delete"}}, true},
+		{
+			rbac.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods", "services"}, Verbs: []string{"get", "list"}},
+			rbac.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"list"}},
+			true,
+		},
+		{
+			rbac.PolicyRule{APIGroups: []string{"apps"}, Resources: []string{"*/scale"}, Verbs: []string{"update"}},
+			rbac.PolicyRule{APIGroups: []string{"apps"}, Resources: []string{"deployments/scale"}, Verbs: []string{"update"}},
+			true,
+		},
+		{
+			rbac.PolicyRule{NonResourceURLs: []string{"/healthz/*"}, Verbs: []string{"get"}},
+			rbac.PolicyRule{NonResourceURLs: []string{"/healthz/ready"}, Verbs: []string{"get"}},
+			true,
+		},
+		{
+			rbac.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, ResourceNames: []string{"web"}, Verbs: []string{"get"}},
+			rbac.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}},
+			false,
+		},
+	}
+	for i, test := range tests {
+		role := Role("test", test.existing)
+		Roles{Items: []*rbac.Role{role}}.Apply(PolicyRule(test.rule))
+		if covered := len(role.Rules) == 1 && reflect.DeepEqual(role.Rules[0], test.existing); covered != test.covered {
+			t.Errorf("test %d: expected covered=%v, got rules %+v", i, test.covered, role.Rules)
+		}
+	}
+}
+
+func TestPolicyRuleDoesNotAlias(t *testing.T) {
+	verbs := make([]string, 1, 4)
+	verbs[0] = "get"
+	existing := rbac.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: verbs}
+	role := Role("test", existing)
+	Roles{Items: []*rbac.Role{role}}.Apply(PolicyRule(rbac.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"list"}}))
+
+	if exp := []string{"get", "list"}; !reflect.DeepEqual(role.Rules[0].Verbs, exp) {
+		t.Errorf("expected verbs %v, got %v", exp, role.Rules[0].Verbs)
+	}
+	if extended := verbs[:2]; extended[1] != "" {
+		t.Errorf("expected the caller's verbs not to be modified, got %v", extended)
+	}
+}
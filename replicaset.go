@@ -0,0 +1,13 @@
+package kg
+
+import kubeext "k8s.io/api/apps/v1"
+
+type ReplicaSetOp func(rs *kubeext.ReplicaSet)
+
+func ReplicaSetPod(podOps ...PodSpecOp) ReplicaSetOp {
+	return func(rs *kubeext.ReplicaSet) {
+		for _, op := range podOps {
+			op(&rs.Spec.Template.Spec)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+package kg
+
+import (
+	"fmt"
+
+	apps "k8s.io/api/apps/v1"
+	autoscaling "k8s.io/api/autoscaling/v2"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	policy "k8s.io/api/policy/v1"
+	rbac "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Filter reports whether an object should be selected.
+type Filter func(obj Object) bool
+
+// Named selects objects with any of the given names. The name "*" selects every object.
+func Named(names ...string) Filter {
+	nameSet := make(map[string]struct{})
+	for _, name := range names {
+		if name == "*" {
+			return func(obj Object) bool { return true }
+		}
+		nameSet[name] = struct{}{}
+	}
+	return func(obj Object) bool {
+		_, exists := nameSet[obj.GetName()]
+		return exists
+	}
+}
+
+// WithLabels selects objects whose labels match a label selector string such as
+// "tier=backend,env in (prod,staging)".
+func WithLabels(selector string) Filter {
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return invalidFilter(fmt.Sprintf("WithLabels(%q)", selector), err)
+	}
+	return func(obj Object) bool {
+		return sel.Matches(labels.Set(obj.GetLabels()))
+	}
+}
+
+// WithLabelSelector selects objects whose labels match selector.
+func WithLabelSelector(selector *metav1.LabelSelector) Filter {
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return invalidFilter(fmt.Sprintf("WithLabelSelector(%v)", selector), err)
+	}
+	return func(obj Object) bool {
+		return sel.Matches(labels.Set(obj.GetLabels()))
+	}
+}
+
+// invalidFilter returns a Filter that fails the Select it is passed to.
+func invalidFilter(op string, err error) Filter {
+	return func(obj Object) bool {
+		Fail(op, err)
+		return false
+	}
+}
+
+// InNamespace selects objects whose metadata.namespace is namespace. Objects without a namespace
+// are only selected by InNamespace("").
+func InNamespace(namespace string) Filter {
+	return func(obj Object) bool {
+		return obj.GetNamespace() == namespace
+	}
+}
+
+// OfKind selects objects of the given kind, such as "Deployment".
+func OfKind(kind string) Filter {
+	return func(obj Object) bool {
+		return obj.GetObjectKind().GroupVersionKind().Kind == kind
+	}
+}
+
+// WithAnnotation selects objects that have the annotation key set to value.
+func WithAnnotation(key, value string) Filter {
+	return func(obj Object) bool {
+		v, ok := obj.GetAnnotations()[key]
+		return ok && v == value
+	}
+}
+
+// HasAnnotation selects objects that have the annotation key, whatever its value.
+func HasAnnotation(key string) Filter {
+	return func(obj Object) bool {
+		_, ok := obj.GetAnnotations()[key]
+		return ok
+	}
+}
+
+// Selection is a set of objects of any kind. Its methods return the selected objects of a
+// particular kind, which can then be modified with Apply.
+type Selection struct {
+	c    *Cluster
+	objs []runtime.Object
+}
+
+// Select selects the objects in the cluster that match all filters. An invalid filter is recorded
+// as an error of the cluster and selects nothing.
+func (c *Cluster) Select(filters ...Filter) *Selection {
+	return &Selection{c: c, objs: c.filter(filters)}
+}
+
+func (c *Cluster) filter(filters []Filter) (objs []runtime.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.recordFailure(r)
+			objs = nil
+		}
+	}()
+	for _, obj := range c.objects() {
+		if matchFilters(obj.(Object), filters) {
+			objs = append(objs, obj)
+		}
+	}
+	return objs
+}
+
+func matchFilters(obj Object, filters []Filter) bool {
+	for _, filter := range filters {
+		if !filter(obj) {
+			return false
+		}
+	}
+	return true
+}
+
+// Delete deletes the selected objects, of every kind, from the cluster.
+func (s *Selection) Delete() {
+	for _, obj := range s.objs {
+		s.c.Delete(obj.(Object))
+	}
+}
+
+func (s *Selection) Deployments() (selected Deployments) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if deploy, ok := obj.(*apps.Deployment); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, deploy)
+		}
+	}
+	return selected
+}
+
+func (s *Selection) StatefulSets() (selected StatefulSets) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if sset, ok := obj.(*apps.StatefulSet); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, sset)
+		}
+	}
+	return selected
+}
+
+func (s *Selection) DaemonSets() (selected DaemonSets) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if ds, ok := obj.(*apps.DaemonSet); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, ds)
+		}
+	}
+	return selected
+}
+
+func (s *Selection) Jobs() (selected Jobs) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if job, ok := obj.(*batch.Job); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, job)
+		}
+	}
+	return selected
+}
+
+func (s *Selection) CronJobs() (selected CronJobs) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if cronJob, ok := obj.(*batch.CronJob); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, cronJob)
+		}
+	}
+	return selected
+}
+
+func (s *Selection) ReplicaSets() (selected ReplicaSets) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if rs, ok := obj.(*apps.ReplicaSet); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, rs)
+		}
+	}
+	return selected
+}
+
+// Workloads returns the selected objects of every kind that runs pods from a pod template.
+func (s *Selection) Workloads() (selected Workloads) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if w, ok := workload(obj); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, w)
+		}
+	}
+	return selected
+}
+
+func (s *Selection) PersistentVolumes() (selected PersistentVolumes) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if pv, ok := obj.(*core.PersistentVolume); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, pv)
+		}
+	}
+	return selected
+}
+
+func (s *Selection) PersistentVolumeClaims() (selected PersistentVolumeClaims) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if pvc, ok := obj.(*core.PersistentVolumeClaim); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, pvc)
+		}
+	}
+	return selected
+}
+
+func (s *Selection) ConfigMaps() (selected ConfigMaps) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if cm, ok := obj.(*core.ConfigMap); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, cm)
+		}
+	}
+	return selected
+}
+
+func (s *Selection) Secrets() (selected Secrets) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if secret, ok := obj.(*core.Secret); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, secret)
+		}
+	}
+	return selected
+}
+
+func (s *Selection) Services() (selected Services) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if svc, ok := obj.(*core.Service); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, svc)
+		}
+	}
+	return selected
+}
+
+func (s *Selection) Ingresses() (selected Ingresses) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if ing, ok := obj.(*networking.Ingress); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, ing)
+		}
+	}
+	return selected
+}
+
+func (s *Selection) HorizontalPodAutoscalers() (selected HorizontalPodAutoscalers) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if hpa, ok := obj.(*autoscaling.HorizontalPodAutoscaler); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, hpa)
+		}
+	}
+	return selected
+}
+
+func (s *Selection) PodDisruptionBudgets() (selected PodDisruptionBudgets) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if pdb, ok := obj.(*policy.PodDisruptionBudget); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, pdb)
+		}
+	}
+	return selected
+}
+
+func (s *Selection) NetworkPolicies() (selected NetworkPolicies) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if np, ok := obj.(*networking.NetworkPolicy); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, np)
+		}
+	}
+	return selected
+}
+
+func (s *Selection) Namespaces() (selected Namespaces) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if ns, ok := obj.(*core.Namespace); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, ns)
+		}
+	}
+	return selected
+}
+
+func (s *Selection) ResourceQuotas() (selected ResourceQuotas) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if quota, ok := obj.(*core.ResourceQuota); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, quota)
+		}
+	}
+	return selected
+}
+
+func (s *Selection) LimitRanges() (selected LimitRanges) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if lr, ok := obj.(*core.LimitRange); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, lr)
+		}
+	}
+	return selected
+}
+
+func (s *Selection) Roles() (selected Roles) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if role, ok := obj.(*rbac.Role); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, role)
+		}
+	}
+	return selected
+}
+
+func (s *Selection) ClusterRoles() (selected ClusterRoles) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if role, ok := obj.(*rbac.ClusterRole); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, role)
+		}
+	}
+	return selected
+}
+
+func (s *Selection) RoleBindings() (selected RoleBindings) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if binding, ok := obj.(*rbac.RoleBinding); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, binding)
+		}
+	}
+	return selected
+}
+
+func (s *Selection) ClusterRoleBindings() (selected ClusterRoleBindings) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if binding, ok := obj.(*rbac.ClusterRoleBinding); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, binding)
+		}
+	}
+	return selected
+}
+
+func (s *Selection) ServiceAccounts() (selected ServiceAccounts) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if sa, ok := obj.(*core.ServiceAccount); ok {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, sa)
+		}
+	}
+	return selected
+}
+
+// Unstructured returns the selected objects whose kind is not registered with the client-go
+// scheme. Empty fields of gvk match any group, version or kind.
+func (s *Selection) Unstructured(gvk schema.GroupVersionKind) (selected UnstructuredObjects) {
+	selected.c = s.c
+	for _, obj := range s.objs {
+		if u, ok := obj.(*unstructured.Unstructured); ok && matchGVK(gvk, u.GroupVersionKind()) {
+			s.c.touch(obj)
+			selected.Items = append(selected.Items, u)
+		}
+	}
+	return selected
+}
+
+// matchGVK reports whether gvk matches pattern, treating empty fields of pattern as wildcards.
+func matchGVK(pattern, gvk schema.GroupVersionKind) bool {
+	return (pattern.Group == "" || pattern.Group == gvk.Group) &&
+		(pattern.Version == "" || pattern.Version == gvk.Version) &&
+		(pattern.Kind == "" || pattern.Kind == gvk.Kind)
+}
@@ -0,0 +1,158 @@
+package kg
+
+import (
+	"strconv"
+
+	kube "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func Service(name string, ops ...ServiceOp) *kube.Service {
+	return ServiceForApp(name, name, ops...)
+}
+
+func ServiceForApp(name string, app string, ops ...ServiceOp) *kube.Service {
+	svc := &kube.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				"app": app,
+			},
+			Annotations: make(map[string]string),
+		},
+		Spec: kube.ServiceSpec{
+			Type: kube.ServiceTypeClusterIP,
+			Selector: map[string]string{
+				"app": app,
+			},
+		},
+	}
+
+	for _, op := range ops {
+		op(svc)
+	}
+
+	return svc
+}
+
+type ServiceOp func(*kube.Service)
+
+// ServicePort adds a port that targets the container port of the same name, or updates the
+// existing port with that name.
+func ServicePort(name string, port int32) ServiceOp {
+	return func(svc *kube.Service) {
+		p := servicePort(svc, name)
+		p.Port = port
+		p.TargetPort = intstr.FromString(name)
+	}
+}
+
+// NodePort makes svc a NodePort service and adds or updates the port with the given name,
+// exposing it on the same port of every node.
+func NodePort(name string, port int32) ServiceOp {
+	return func(svc *kube.Service) {
+		svc.Spec.Type = kube.ServiceTypeNodePort
+		p := servicePort(svc, name)
+		p.Port = port
+		p.NodePort = port
+		p.TargetPort = intstr.FromString(name)
+	}
+}
+
+// servicePort returns the port of svc with the given name, adding it if it does not exist.
+func servicePort(svc *kube.Service, name string) *kube.ServicePort {
+	for i := range svc.Spec.Ports {
+		if svc.Spec.Ports[i].Name == name {
+			return &svc.Spec.Ports[i]
+		}
+	}
+	svc.Spec.Ports = append(svc.Spec.Ports, kube.ServicePort{Name: name})
+	return &svc.Spec.Ports[len(svc.Spec.Ports)-1]
+}
+
+// RemoveServicePort removes the port with the given name, if it exists.
+func RemoveServicePort(name string) ServiceOp {
+	return func(svc *kube.Service) {
+		for i := range svc.Spec.Ports {
+			if svc.Spec.Ports[i].Name == name {
+				svc.Spec.Ports = append(svc.Spec.Ports[:i], svc.Spec.Ports[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func MetricsPort(port int32) ServiceOp {
+	return ServiceAnnotations(map[string]string{
+		"prometheus.io/scrape": "true",
+		"prometheus.io/port":   strconv.Itoa(int(port)),
+	})
+}
+
+func MetricsPortWithPath(port int32, path string) ServiceOp {
+	return ServiceAnnotations(map[string]string{
+		"prometheus.io/scrape": "true",
+		"prometheus.io/path":   path,
+		"prometheus.io/port":   strconv.Itoa(int(port)),
+	})
+}
+
+// ServiceAnnotations merges annotations into the service's annotations.
+func ServiceAnnotations(annotations map[string]string) ServiceOp {
+	return func(svc *kube.Service) {
+		if svc.ObjectMeta.Annotations == nil {
+			svc.ObjectMeta.Annotations = make(map[string]string)
+		}
+		for k, v := range annotations {
+			svc.ObjectMeta.Annotations[k] = v
+		}
+	}
+}
+
+func PublicIP(ip string) ServiceOp {
+	return func(svc *kube.Service) {
+		svc.Spec.Type = kube.ServiceTypeLoadBalancer
+		svc.Spec.LoadBalancerIP = ip
+	}
+}
+
+// Headless makes svc a headless service. A placeholder port is added if svc has no ports.
+func Headless() ServiceOp {
+	return func(svc *kube.Service) {
+		svc.Spec.ClusterIP = "None"
+		if len(svc.Spec.Ports) == 0 {
+			svc.Spec.Ports = append(svc.Spec.Ports, kube.ServicePort{
+				Name:       "unused",
+				Port:       10811,
+				TargetPort: intstr.FromInt(10811),
+			})
+		}
+	}
+}
+
+// Selector merges labels into both the service's labels and its pod selector.
+func Selector(labels map[string]string) ServiceOp {
+	return func(svc *kube.Service) {
+		if svc.ObjectMeta.Labels == nil {
+			svc.ObjectMeta.Labels = make(map[string]string)
+		}
+		if svc.Spec.Selector == nil {
+			svc.Spec.Selector = make(map[string]string)
+		}
+		for k, v := range labels {
+			svc.ObjectMeta.Labels[k] = v
+			svc.Spec.Selector[k] = v
+		}
+	}
+}
+
+// GroupedService creates a headless service on pods with the label
+// "group"=group. This is used to hint at the scheduler to not place them on
+// the same nodes.
+func GroupedService(group string) *kube.Service {
+	svc := Service(group, Headless())
+	svc.ObjectMeta.Labels = map[string]string{"group": group}
+	svc.Spec.Selector = map[string]string{"group": group}
+	return svc
+}
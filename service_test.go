@@ -0,0 +1,44 @@
+package kg
+
+import (
+	"reflect"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+)
+
+func TestServiceOpsIdempotent(t *testing.T) {
+	ops := []ServiceOp{
+		ServicePort("http", 80),
+		NodePort("https", 443),
+		MetricsPort(6060),
+		Selector(map[string]string{"tier": "frontend"}),
+		Headless(),
+	}
+
+	once := Service("frontend", ops...)
+	twice := Service("frontend", ops...)
+	Services{Items: []*core.Service{twice}}.Apply(ops...)
+	if !reflect.DeepEqual(once, twice) {
+		t.Errorf("expected applying ops twice to be a no-op, got\n%+v\nand\n%+v", once, twice)
+	}
+
+	if n := len(once.Spec.Ports); n != 2 {
+		t.Errorf("expected 2 ports, got %d", n)
+	}
+	exp := map[string]string{"app": "frontend", "tier": "frontend"}
+	if !reflect.DeepEqual(once.Spec.Selector, exp) {
+		t.Errorf("expected selector %v, got %v", exp, once.Spec.Selector)
+	}
+}
+
+func TestGroupedService(t *testing.T) {
+	svc := GroupedService("indexers")
+	exp := map[string]string{"group": "indexers"}
+	if !reflect.DeepEqual(svc.Spec.Selector, exp) {
+		t.Errorf("expected selector %v, got %v", exp, svc.Spec.Selector)
+	}
+	if !reflect.DeepEqual(svc.Labels, exp) {
+		t.Errorf("expected labels %v, got %v", exp, svc.Labels)
+	}
+}
@@ -0,0 +1,67 @@
+package kg
+
+import kube "k8s.io/api/core/v1"
+
+type ServiceAccountOp func(sa *kube.ServiceAccount)
+
+// ImagePullSecret adds the named secret to the secrets used to pull the images of pods that run
+// as the service account, if it is not already present.
+func ImagePullSecret(name string) ServiceAccountOp {
+	return func(sa *kube.ServiceAccount) {
+		for _, ref := range sa.ImagePullSecrets {
+			if ref.Name == name {
+				return
+			}
+		}
+		sa.ImagePullSecrets = append(sa.ImagePullSecrets, kube.LocalObjectReference{Name: name})
+	}
+}
+
+// RemoveImagePullSecret removes the named secret from the image pull secrets, if it exists.
+func RemoveImagePullSecret(name string) ServiceAccountOp {
+	return func(sa *kube.ServiceAccount) {
+		for i := range sa.ImagePullSecrets {
+			if sa.ImagePullSecrets[i].Name == name {
+				sa.ImagePullSecrets = append(sa.ImagePullSecrets[:i], sa.ImagePullSecrets[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// AutomountToken sets whether the service account's API token is mounted into its pods.
+func AutomountToken(automount bool) ServiceAccountOp {
+	return func(sa *kube.ServiceAccount) {
+		sa.AutomountServiceAccountToken = BoolPtr(automount)
+	}
+}
+
+// ServiceAccountAnnotations merges annotations into the service account's annotations.
+func ServiceAccountAnnotations(annotations map[string]string) ServiceAccountOp {
+	return func(sa *kube.ServiceAccount) {
+		if sa.Annotations == nil {
+			sa.Annotations = make(map[string]string)
+		}
+		for k, v := range annotations {
+			sa.Annotations[k] = v
+		}
+	}
+}
+
+// GKEWorkloadIdentity lets pods that run as the service account act as the given Google service
+// account, e.g. "app@project.iam.gserviceaccount.com".
+func GKEWorkloadIdentity(gcpServiceAccount string) ServiceAccountOp {
+	return ServiceAccountAnnotations(map[string]string{"iam.gke.io/gcp-service-account": gcpServiceAccount})
+}
+
+// EKSRoleARN lets pods that run as the service account assume the given AWS IAM role.
+func EKSRoleARN(roleARN string) ServiceAccountOp {
+	return ServiceAccountAnnotations(map[string]string{"eks.amazonaws.com/role-arn": roleARN})
+}
+
+// AzureWorkloadIdentity lets pods that run as the service account authenticate as the Azure
+// managed identity with the given client ID. The pods must also be labeled
+// azure.workload.identity/use=true, e.g. with PodLabels.
+func AzureWorkloadIdentity(clientID string) ServiceAccountOp {
+	return ServiceAccountAnnotations(map[string]string{"azure.workload.identity/client-id": clientID})
+}
@@ -0,0 +1,40 @@
+package kg
+
+import (
+	"reflect"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestServiceAccountOps(t *testing.T) {
+	ops := []ServiceAccountOp{
+		ImagePullSecret("registry"),
+		ImagePullSecret("mirror"),
+		AutomountToken(false),
+		GKEWorkloadIdentity("app@project.iam.gserviceaccount.com"),
+		EKSRoleARN("arn:aws:iam::123456789012:role/app"),
+		AzureWorkloadIdentity("00000000-0000-0000-0000-000000000000"),
+	}
+	sa := &core.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "app"}}
+	sas := ServiceAccounts{Items: []*core.ServiceAccount{sa}}
+	sas.Apply(ops...)
+	sas.Apply(ops...)
+	sas.Apply(RemoveImagePullSecret("mirror"), RemoveImagePullSecret("missing"))
+
+	if exp := []core.LocalObjectReference{{Name: "registry"}}; !reflect.DeepEqual(sa.ImagePullSecrets, exp) {
+		t.Errorf("expected image pull secrets %v, got %v", exp, sa.ImagePullSecrets)
+	}
+	if sa.AutomountServiceAccountToken == nil || *sa.AutomountServiceAccountToken {
+		t.Errorf("expected the token not to be mounted, got %v", sa.AutomountServiceAccountToken)
+	}
+	exp := map[string]string{
+		"iam.gke.io/gcp-service-account":    "app@project.iam.gserviceaccount.com",
+		"eks.amazonaws.com/role-arn":        "arn:aws:iam::123456789012:role/app",
+		"azure.workload.identity/client-id": "00000000-0000-0000-0000-000000000000",
+	}
+	if !reflect.DeepEqual(sa.Annotations, exp) {
+		t.Errorf("expected annotations %v, got %v", exp, sa.Annotations)
+	}
+}
@@ -2,10 +2,19 @@ package kg
 
 import (
 	kubeext "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 type StatefulSetOp func(sset *kubeext.StatefulSet)
 
+// newStatefulSet returns an empty StatefulSet whose pods are labeled and selected by app=name.
+func newStatefulSet(name string) *kubeext.StatefulSet {
+	sset := &kubeext.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	sset.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}}
+	sset.Spec.Template.ObjectMeta.Labels = map[string]string{"app": name}
+	return sset
+}
+
 func StatefulSetReplicas(count int32) StatefulSetOp {
 	return func(sset *kubeext.StatefulSet) {
 		sset.Spec.Replicas = IntPtr(count)
@@ -19,3 +28,10 @@ func StatefulSetPod(podOps ...PodSpecOp) StatefulSetOp {
 		}
 	}
 }
+
+// RemoveStatefulSetReplicas removes the replica count, leaving it to be managed by an autoscaler.
+func RemoveStatefulSetReplicas() StatefulSetOp {
+	return func(sset *kubeext.StatefulSet) {
+		sset.Spec.Replicas = nil
+	}
+}
@@ -0,0 +1,90 @@
+package kg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// UnstructuredOp modifies an object of a kind that is not registered with the client-go scheme.
+// Fields are addressed by path, e.g. SetField("cert-manager", "spec", "issuerRef", "name").
+type UnstructuredOp func(u *unstructured.Unstructured)
+
+// SetField sets the field at the given path to value, creating intermediate maps as needed. value
+// must be representable as JSON.
+func SetField(value interface{}, fields ...string) UnstructuredOp {
+	return func(u *unstructured.Unstructured) {
+		op := fmt.Sprintf("SetField(%v, %q)", value, strings.Join(fields, "."))
+		if err := unstructured.SetNestedField(u.Object, jsonValue(op, value), fields...); err != nil {
+			Fail(op, err)
+		}
+	}
+}
+
+// MergeField merges values into the map at the given path, creating it if it does not exist.
+// Nested maps are merged recursively, as by Merge.
+func MergeField(values map[string]interface{}, fields ...string) UnstructuredOp {
+	return func(u *unstructured.Unstructured) {
+		op := fmt.Sprintf("MergeField(%v, %q)", values, strings.Join(fields, "."))
+		m, _, err := unstructured.NestedMap(u.Object, fields...)
+		if err != nil {
+			Fail(op, err)
+		}
+		if m == nil {
+			m = make(map[string]interface{})
+		}
+		// A nil values is encoded as null, which merges nothing
+		patch, _ := jsonValue(op, values).(map[string]interface{})
+		Merge(m, patch)
+		if err := unstructured.SetNestedMap(u.Object, m, fields...); err != nil {
+			Fail(op, err)
+		}
+	}
+}
+
+// RemoveField removes the field at the given path, if it exists.
+func RemoveField(fields ...string) UnstructuredOp {
+	return func(u *unstructured.Unstructured) {
+		unstructured.RemoveNestedField(u.Object, fields...)
+	}
+}
+
+// jsonValue converts v to the representation used by unstructured objects, in which maps are
+// map[string]interface{}, arrays are []interface{} and numbers are int64 or float64. It fails op
+// if v cannot be represented as JSON.
+func jsonValue(op string, v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		Fail(op, err)
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var out interface{}
+	if err := d.Decode(&out); err != nil {
+		Fail(op, err)
+	}
+	return convertNumbers(out)
+}
+
+func convertNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = convertNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = convertNumbers(e)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
@@ -0,0 +1,22 @@
+package kg
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestMergeFieldNil(t *testing.T) {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(1)}}}
+	MergeField(nil, "spec")(u)
+	MergeField(nil, "status")(u)
+
+	exp := map[string]interface{}{
+		"spec":   map[string]interface{}{"replicas": int64(1)},
+		"status": map[string]interface{}{},
+	}
+	if !reflect.DeepEqual(u.Object, exp) {
+		t.Errorf("expected %v, got %v", exp, u.Object)
+	}
+}
@@ -0,0 +1,74 @@
+package kg
+
+import (
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	kube "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Workload is an object that runs pods from a pod template: a Deployment, StatefulSet, DaemonSet,
+// ReplicaSet, Job or CronJob.
+type Workload struct {
+	Object
+
+	// Template is the object's pod template
+	Template *kube.PodTemplateSpec
+}
+
+// PodTemplateOp modifies the pod template of a workload of any kind.
+type PodTemplateOp func(template *kube.PodTemplateSpec)
+
+// workload returns obj as a Workload, or false if obj does not have a pod template.
+func workload(obj runtime.Object) (Workload, bool) {
+	var template *kube.PodTemplateSpec
+	switch obj := obj.(type) {
+	case *apps.Deployment:
+		template = &obj.Spec.Template
+	case *apps.StatefulSet:
+		template = &obj.Spec.Template
+	case *apps.DaemonSet:
+		template = &obj.Spec.Template
+	case *apps.ReplicaSet:
+		template = &obj.Spec.Template
+	case *batch.Job:
+		template = &obj.Spec.Template
+	case *batch.CronJob:
+		template = &obj.Spec.JobTemplate.Spec.Template
+	default:
+		return Workload{}, false
+	}
+	return Workload{Object: obj.(Object), Template: template}, true
+}
+
+func WorkloadPod(podOps ...PodSpecOp) PodTemplateOp {
+	return func(template *kube.PodTemplateSpec) {
+		for _, op := range podOps {
+			op(&template.Spec)
+		}
+	}
+}
+
+// PodLabels merges labels into the labels of the pod template. Selectors are not changed.
+func PodLabels(labels map[string]string) PodTemplateOp {
+	return func(template *kube.PodTemplateSpec) {
+		if template.Labels == nil {
+			template.Labels = make(map[string]string)
+		}
+		for k, v := range labels {
+			template.Labels[k] = v
+		}
+	}
+}
+
+// PodAnnotations merges annotations into the annotations of the pod template.
+func PodAnnotations(annotations map[string]string) PodTemplateOp {
+	return func(template *kube.PodTemplateSpec) {
+		if template.Annotations == nil {
+			template.Annotations = make(map[string]string)
+		}
+		for k, v := range annotations {
+			template.Annotations[k] = v
+		}
+	}
+}